@@ -0,0 +1,53 @@
+package plumber
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jenkins-x/jx/pkg/tekton/metapipeline"
+)
+
+// AzureDevOpsAuth configures how meta-pipeline creation clones an Azure DevOps repo: unlike
+// the other providers lighthouse supports, Azure repos authenticate over HTTPS with a
+// personal access token embedded in the clone URL rather than an SSH deploy key.
+type AzureDevOpsAuth struct {
+	// Organization is the Azure DevOps organization, e.g. "my-org".
+	Organization string
+	// Project is the Azure DevOps project the repo lives in.
+	Project string
+	// PersonalAccessToken authenticates the clone; Azure accepts it as the password half of
+	// HTTP basic auth with an empty username.
+	PersonalAccessToken string
+}
+
+// IsAzureDevOpsRepo reports whether gitServerURL points at Azure DevOps Services, the only
+// place lighthouse currently needs AzureDevOpsAuth's clone URL handling.
+func IsAzureDevOpsRepo(gitServerURL string) bool {
+	u, err := url.Parse(gitServerURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(u.Host, "dev.azure.com") || strings.HasSuffix(u.Host, "visualstudio.com")
+}
+
+// CloneURL builds the authenticated HTTPS clone URL metapipeline.Client needs for an Azure
+// DevOps repo, embedding auth.PersonalAccessToken so the meta-pipeline's git clone step
+// doesn't depend on an SSH deploy key like the other providers.
+func (auth AzureDevOpsAuth) CloneURL(repo string) string {
+	return fmt.Sprintf("https://:%s@dev.azure.com/%s/%s/_git/%s", auth.PersonalAccessToken, auth.Organization, auth.Project, repo)
+}
+
+// AzureDevOpsMetaPipelineClient wraps a metapipeline.Client created for an Azure DevOps repo,
+// making Auth's PAT-authenticated clone URL available to the caller that builds the PullRef
+// passed to Client.Create, via CloneURLForRepo. It implements metapipeline.Client itself by
+// embedding, so it can be returned anywhere a plain metapipeline.Client is expected.
+type AzureDevOpsMetaPipelineClient struct {
+	metapipeline.Client
+	Auth AzureDevOpsAuth
+}
+
+// CloneURLForRepo resolves the PAT-authenticated HTTPS clone URL for repo.
+func (c *AzureDevOpsMetaPipelineClient) CloneURLForRepo(repo string) string {
+	return c.Auth.CloneURL(repo)
+}
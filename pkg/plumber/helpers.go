@@ -16,7 +16,14 @@ import (
 // NewMetaPipelineClient creates a new client for the creation and application of meta pipelines.
 // The responsibility of the meta pipeline is to prepare the execution pipeline and to allow Apps to contribute
 // the this execution pipeline.
-func NewMetaPipelineClient(factory jxfactory.Factory) (metapipeline.Client, error) {
+//
+// gitServerURL is the git server the pipeline being created will clone from. When it points at
+// Azure DevOps Services and azureAuth is non-nil, the returned client is wrapped so callers that
+// need a clone URL for the repo (rather than relying on an SSH deploy key, which Azure DevOps
+// Services doesn't accept the same way the other providers do) can resolve the PAT-authenticated
+// HTTPS one via AzureDevOpsMetaPipelineClient.CloneURLForRepo. azureAuth may be nil for non-Azure
+// git servers.
+func NewMetaPipelineClient(factory jxfactory.Factory, gitServerURL string, azureAuth *AzureDevOpsAuth) (metapipeline.Client, error) {
 	if factory == nil {
 		logrus.Warn("no jxfactory passed in to create metapipeline.Client: %s", string(debug.Stack()))
 		factory = jxfactory.NewFactory()
@@ -25,7 +32,14 @@ func NewMetaPipelineClient(factory jxfactory.Factory) (metapipeline.Client, erro
 	if err != nil {
 		return nil, err
 	}
-	return metapipeline.NewMetaPipelineClientWithClientsAndNamespace(jxClient, tektonClient, kubeClient, ns)
+	client, err := metapipeline.NewMetaPipelineClientWithClientsAndNamespace(jxClient, tektonClient, kubeClient, ns)
+	if err != nil {
+		return nil, err
+	}
+	if azureAuth != nil && IsAzureDevOpsRepo(gitServerURL) {
+		return &AzureDevOpsMetaPipelineClient{Client: client, Auth: *azureAuth}, nil
+	}
+	return client, nil
 }
 
 func getClientsAndNamespace(factory jxfactory.Factory) (tektonclient.Interface, jxclient.Interface, kubeclient.Interface, string, error) {
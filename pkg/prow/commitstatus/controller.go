@@ -0,0 +1,282 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package commitstatus reconciles the Tekton PipelineRuns plumber.NewMetaPipelineClient
+// creates back to commit statuses/check-runs on the originating SCM, closing the gap where a
+// transient SCM outage during pipeline completion would otherwise leave a PR stuck "pending".
+package commitstatus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	tektonv1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/jenkins-x/lighthouse/pkg/prow/gitprovider"
+)
+
+// Labels the controller expects on every PipelineRun it reconciles. plumber.NewMetaPipelineClient
+// delegates pipeline creation to the external jx/pkg/tekton/metapipeline client, which this repo
+// doesn't vendor, so these exact keys are an assumption carried over from that client's behavior
+// rather than something checked against its source here. If PipelineRuns show up without them,
+// ResyncAll/Resync will silently skip them (coalesceKey returns ""): verify the keys against
+// metapipeline's actual label-setting code, or capture a sample PipelineRun's labels, before
+// relying on this controller in a new environment.
+const (
+	LabelGUID    = "lighthouse.jenkins-x.io/id"
+	LabelOrg     = "lighthouse.jenkins-x.io/refs.org"
+	LabelRepo    = "lighthouse.jenkins-x.io/refs.repo"
+	LabelSHA     = "lighthouse.jenkins-x.io/refs.sha"
+	LabelContext = "lighthouse.jenkins-x.io/context"
+)
+
+// StatusSetter is the subset of an SCM client the controller needs to post commit statuses.
+// Both gitprovider.Client and gitprovider.AzureDevOpsClient satisfy it.
+type StatusSetter interface {
+	SetStatus(repo, sha string, status *scm.Status) error
+}
+
+// Controller watches (by polling, see Run) Tekton PipelineRuns created by
+// plumber.NewMetaPipelineClient and reconciles their status back to the originating SCM.
+type Controller struct {
+	TektonClient tektonclient.Interface
+	Namespace    string
+	// StatusSetterFor returns the SCM client to post statuses through for org/repo, so a
+	// single controller can serve repos on different SCM providers (including Azure DevOps).
+	StatusSetterFor func(org, repo string) (StatusSetter, error)
+	Logger          *logrus.Entry
+
+	// PollInterval is how often Run re-lists PipelineRuns to catch up missed webhook
+	// deliveries/status updates. Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+
+	mu     sync.Mutex
+	posted map[string]string // coalesceKey -> last scm.State posted, so reconciles are idempotent
+}
+
+// DefaultPollInterval bounds how stale the re-sync loop's view of pipeline status can get.
+const DefaultPollInterval = time.Minute
+
+// NewController creates a Controller for the given Tekton client/namespace.
+func NewController(tektonClient tektonclient.Interface, namespace string, statusSetterFor func(org, repo string) (StatusSetter, error)) *Controller {
+	return &Controller{
+		TektonClient:    tektonClient,
+		Namespace:       namespace,
+		StatusSetterFor: statusSetterFor,
+		Logger:          logrus.WithField("controller", "commitstatus"),
+		posted:          map[string]string{},
+	}
+}
+
+// NewAzureDevOpsStatusSetterFor returns a StatusSetterFor callback that posts commit statuses
+// through a gitprovider.AzureDevOpsClient scoped to the given Azure DevOps organization,
+// for use when Controller serves repos hosted on Azure DevOps Services rather than GitHub.
+func NewAzureDevOpsStatusSetterFor(baseURL, personalAccessToken string) func(org, repo string) (StatusSetter, error) {
+	return func(org, _ string) (StatusSetter, error) {
+		return gitprovider.NewAzureDevOpsClient(baseURL, org, personalAccessToken), nil
+	}
+}
+
+func (c *Controller) pollInterval() time.Duration {
+	if c.PollInterval > 0 {
+		return c.PollInterval
+	}
+	return DefaultPollInterval
+}
+
+// Run blocks, re-syncing every PollInterval until ctx is cancelled. It is the periodic
+// catch-up loop: webhook-driven reconciles (not implemented by this polling controller, but
+// expected to call Resync directly as PipelineRun events come in from an informer) handle
+// the common case, and Run guarantees eventual consistency when one is missed.
+func (c *Controller) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.pollInterval())
+	defer ticker.Stop()
+	for {
+		if err := c.ResyncAll(ctx); err != nil {
+			c.Logger.WithError(err).Error("Error re-syncing pipeline run statuses.")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ResyncAll reconciles every PipelineRun lighthouse has created.
+func (c *Controller) ResyncAll(ctx context.Context) error {
+	runs, err := c.TektonClient.TektonV1beta1().PipelineRuns(c.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: LabelGUID,
+	})
+	if err != nil {
+		return errors.Wrap(err, "listing pipeline runs")
+	}
+	c.reconcileAll(ctx, runs.Items)
+	return nil
+}
+
+// Resync forces re-evaluation of every PipelineRun for (org, repo, sha), as triggered by the
+// POST /resync/{org}/{repo}/{sha} admin endpoint.
+func (c *Controller) Resync(ctx context.Context, org, repo, sha string) error {
+	runs, err := c.TektonClient.TektonV1beta1().PipelineRuns(c.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s,%s=%s,%s=%s", LabelOrg, org, LabelRepo, repo, LabelSHA, sha),
+	})
+	if err != nil {
+		return errors.Wrap(err, "listing pipeline runs")
+	}
+	c.reconcileAll(ctx, runs.Items)
+	return nil
+}
+
+func (c *Controller) reconcileAll(ctx context.Context, runs []tektonv1beta1.PipelineRun) {
+	// Coalesce multiple runs for the same (org, repo, sha, context) into the single most
+	// advanced status, so a re-run doesn't regress an already-reported success back to
+	// pending.
+	best := map[string]*tektonv1beta1.PipelineRun{}
+	for i := range runs {
+		run := &runs[i]
+		key := coalesceKey(run)
+		if key == "" {
+			continue
+		}
+		if existing, ok := best[key]; !ok || statusRank(run) > statusRank(existing) {
+			best[key] = run
+		}
+	}
+	for key, run := range best {
+		if err := c.reconcileOne(ctx, key, run); err != nil {
+			c.Logger.WithError(err).WithField("pipelinerun", run.Name).Error("Error reconciling pipeline run status.")
+		}
+	}
+}
+
+func (c *Controller) reconcileOne(ctx context.Context, key string, run *tektonv1beta1.PipelineRun) error {
+	org := run.Labels[LabelOrg]
+	repo := run.Labels[LabelRepo]
+	sha := run.Labels[LabelSHA]
+	pipelineContext := run.Labels[LabelContext]
+
+	status := &scm.Status{
+		State:  statusFor(run),
+		Label:  pipelineContext,
+		Desc:   statusDescription(run),
+		Target: "",
+	}
+
+	c.mu.Lock()
+	last := c.posted[key]
+	c.posted[key] = string(status.State)
+	c.mu.Unlock()
+	if last == string(status.State) {
+		return nil
+	}
+
+	setter, err := c.StatusSetterFor(org, repo)
+	if err != nil {
+		err = errors.Wrap(err, "resolving SCM client")
+	} else {
+		err = setter.SetStatus(repo, sha, status)
+	}
+	if err != nil {
+		// Forget the state so the next re-sync posts it again.
+		c.mu.Lock()
+		c.posted[key] = last
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func coalesceKey(run *tektonv1beta1.PipelineRun) string {
+	org := run.Labels[LabelOrg]
+	repo := run.Labels[LabelRepo]
+	sha := run.Labels[LabelSHA]
+	pipelineContext := run.Labels[LabelContext]
+	if org == "" || repo == "" || sha == "" {
+		return ""
+	}
+	return strings.Join([]string{org, repo, sha, pipelineContext}, "/")
+}
+
+// statusFor maps a PipelineRun's Tekton conditions onto an scm.State.
+func statusFor(run *tektonv1beta1.PipelineRun) scm.State {
+	cond := run.Status.GetCondition("Succeeded")
+	if cond == nil {
+		return scm.StatePending
+	}
+	switch cond.Status {
+	case "True":
+		return scm.StateSuccess
+	case "False":
+		return scm.StateFailure
+	default:
+		return scm.StateRunning
+	}
+}
+
+func statusDescription(run *tektonv1beta1.PipelineRun) string {
+	cond := run.Status.GetCondition("Succeeded")
+	if cond == nil {
+		return "Pipeline is running."
+	}
+	if cond.Message != "" {
+		return cond.Message
+	}
+	return cond.Reason
+}
+
+// statusRank orders states so reconcileAll can pick the most advanced run for a given
+// (org, repo, sha, context): a completed run always wins over a still-running one.
+func statusRank(run *tektonv1beta1.PipelineRun) int {
+	switch statusFor(run) {
+	case scm.StateSuccess, scm.StateFailure:
+		return 2
+	case scm.StateRunning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ResyncHandler serves POST /resync/{org}/{repo}/{sha}, forcing the controller to
+// re-evaluate and re-post commit status for every PipelineRun matching that org/repo/sha.
+func (c *Controller) ResyncHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/resync/"), "/"), "/")
+		if len(parts) != 3 {
+			http.Error(w, "expected path /resync/{org}/{repo}/{sha}", http.StatusBadRequest)
+			return
+		}
+		org, repo, sha := parts[0], parts[1], parts[2]
+		if err := c.Resync(r.Context(), org, repo, sha); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
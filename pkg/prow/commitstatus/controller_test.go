@@ -0,0 +1,130 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commitstatus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+	tektonv1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+func pipelineRun(name string, labels map[string]string, status corev1.ConditionStatus, reason string) *tektonv1beta1.PipelineRun {
+	run := &tektonv1beta1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+	}
+	run.Status.SetCondition(&apis.Condition{
+		Type:   "Succeeded",
+		Status: status,
+		Reason: reason,
+	})
+	return run
+}
+
+type fakeStatusSetter struct {
+	statuses []*scm.Status
+}
+
+func (f *fakeStatusSetter) SetStatus(_, _ string, status *scm.Status) error {
+	f.statuses = append(f.statuses, status)
+	return nil
+}
+
+func TestCoalesceKeyRequiresOrgRepoSHA(t *testing.T) {
+	full := pipelineRun("full", map[string]string{
+		LabelOrg: "o", LabelRepo: "r", LabelSHA: "s", LabelContext: "ci/build",
+	}, corev1.ConditionTrue, "")
+	if got := coalesceKey(full); got != "o/r/s/ci/build" {
+		t.Fatalf("coalesceKey(full) = %q, want %q", got, "o/r/s/ci/build")
+	}
+
+	missing := pipelineRun("missing", map[string]string{LabelOrg: "o"}, corev1.ConditionTrue, "")
+	if got := coalesceKey(missing); got != "" {
+		t.Fatalf("coalesceKey(missing org/repo/sha) = %q, want empty", got)
+	}
+}
+
+func TestStatusRankCompletedBeatsRunning(t *testing.T) {
+	succeeded := pipelineRun("succeeded", nil, corev1.ConditionTrue, "")
+	running := pipelineRun("running", nil, corev1.ConditionUnknown, "Running")
+	// A PipelineRun with no Succeeded condition yet is what statusFor reports as pending.
+	pending := &tektonv1beta1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "pending"}}
+
+	if statusRank(succeeded) <= statusRank(running) {
+		t.Fatalf("statusRank(succeeded)=%d should be greater than statusRank(running)=%d", statusRank(succeeded), statusRank(running))
+	}
+	if statusRank(running) <= statusRank(pending) {
+		t.Fatalf("statusRank(running)=%d should be greater than statusRank(pending)=%d", statusRank(running), statusRank(pending))
+	}
+}
+
+// TestReconcileAllCoalescesToMostAdvancedRun verifies the scenario statusRank exists for: a
+// retried PipelineRun for the same (org, repo, sha, context) must not regress an already-posted
+// success back to pending.
+func TestReconcileAllCoalescesToMostAdvancedRun(t *testing.T) {
+	labels := map[string]string{
+		LabelGUID: "g", LabelOrg: "o", LabelRepo: "r", LabelSHA: "s", LabelContext: "ci/build",
+	}
+	running := pipelineRun("running", labels, corev1.ConditionUnknown, "Running")
+	succeeded := pipelineRun("succeeded", labels, corev1.ConditionTrue, "")
+	// ResyncAll lists PipelineRuns in the controller's namespace only.
+	running.Namespace = "ns"
+	succeeded.Namespace = "ns"
+
+	tektonClient := tektonfake.NewSimpleClientset(running, succeeded)
+	setter := &fakeStatusSetter{}
+	c := NewController(tektonClient, "ns", func(_, _ string) (StatusSetter, error) { return setter, nil })
+
+	if err := c.ResyncAll(context.Background()); err != nil {
+		t.Fatalf("ResyncAll: %v", err)
+	}
+
+	if len(setter.statuses) != 1 {
+		t.Fatalf("expected exactly one status posted, got %d", len(setter.statuses))
+	}
+	if setter.statuses[0].State != scm.StateSuccess {
+		t.Fatalf("expected the coalesced status to be success (from the completed run), got %v", setter.statuses[0].State)
+	}
+}
+
+// TestReconcileOneIsIdempotent verifies reconcileOne only posts a status when it changes, so a
+// repeated poll of an unchanged PipelineRun doesn't spam the SCM with duplicate status calls.
+func TestReconcileOneIsIdempotent(t *testing.T) {
+	labels := map[string]string{
+		LabelOrg: "o", LabelRepo: "r", LabelSHA: "s", LabelContext: "ci/build",
+	}
+	run := pipelineRun("run", labels, corev1.ConditionTrue, "")
+	setter := &fakeStatusSetter{}
+	c := NewController(tektonfake.NewSimpleClientset(run), "ns", func(_, _ string) (StatusSetter, error) { return setter, nil })
+
+	key := coalesceKey(run)
+	if err := c.reconcileOne(context.Background(), key, run); err != nil {
+		t.Fatalf("reconcileOne: %v", err)
+	}
+	if err := c.reconcileOne(context.Background(), key, run); err != nil {
+		t.Fatalf("reconcileOne (second call): %v", err)
+	}
+
+	if len(setter.statuses) != 1 {
+		t.Fatalf("expected exactly one status posted across two identical reconciles, got %d", len(setter.statuses))
+	}
+}
@@ -0,0 +1,379 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitprovider
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/pkg/errors"
+)
+
+// Azure DevOps Service Hooks eventType values lighthouse translates into the existing scm.*
+// hook types, so every current plugin works unchanged against an Azure repo.
+const (
+	AzureEventPush               = "git.push"
+	AzureEventPullRequestCreated = "git.pullrequest.created"
+	AzureEventPullRequestUpdated = "git.pullrequest.updated"
+	AzureEventPullRequestMerged  = "git.pullrequest.merged"
+	AzureEventPullRequestComment = "ms.vss-code.git-pullrequest-comment-event"
+)
+
+// AzureDevOpsClient implements the subset of the SCM interface lighthouse plugins use, against
+// the Azure DevOps Services REST API (dev.azure.com/{org}/{project}/_apis/git/...).
+type AzureDevOpsClient struct {
+	// BaseURL is the organization URL, e.g. https://dev.azure.com/my-org.
+	BaseURL string
+	// Project is the Azure DevOps project the repo lives in.
+	Project string
+	// PersonalAccessToken authenticates REST calls; Azure accepts it as the password half of
+	// HTTP basic auth with an empty or arbitrary username.
+	PersonalAccessToken string
+
+	httpClient *http.Client
+}
+
+// NewAzureDevOpsClient creates a client for the given Azure DevOps organization/project.
+func NewAzureDevOpsClient(baseURL, project, pat string) *AzureDevOpsClient {
+	return &AzureDevOpsClient{
+		BaseURL:             strings.TrimSuffix(baseURL, "/"),
+		Project:             project,
+		PersonalAccessToken: pat,
+		httpClient:          &http.Client{},
+	}
+}
+
+// CreateComment posts comment on a pull request. Azure has no separate issue/PR comment
+// concept, so isPR is accepted for interface symmetry with the other SCM clients but ignored.
+func (c *AzureDevOpsClient) CreateComment(repo string, number int, isPR bool, comment string) error {
+	url := fmt.Sprintf("%s/%s/_apis/git/repositories/%s/pullRequests/%d/threads?api-version=6.0", c.BaseURL, c.Project, repo, number)
+	body, err := json.Marshal(map[string]interface{}{
+		"comments": []map[string]string{{"content": comment, "commentType": "text"}},
+		"status":   "active",
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshalling comment thread")
+	}
+	return c.do(http.MethodPost, url, body)
+}
+
+// ListFiles lists the files changed in a pull request's current iteration.
+func (c *AzureDevOpsClient) ListFiles(repo string, number int) ([]string, error) {
+	url := fmt.Sprintf("%s/%s/_apis/git/repositories/%s/pullRequests/%d/iterations?api-version=6.0", c.BaseURL, c.Project, repo, number)
+	var resp struct {
+		Value []struct {
+			ID int `json:"id"`
+		} `json:"value"`
+	}
+	if err := c.get(url, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Value) == 0 {
+		return nil, nil
+	}
+	latest := resp.Value[len(resp.Value)-1].ID
+	changesURL := fmt.Sprintf("%s/%s/_apis/git/repositories/%s/pullRequests/%d/iterations/%d/changes?api-version=6.0",
+		c.BaseURL, c.Project, repo, number, latest)
+	var changes struct {
+		ChangeEntries []struct {
+			Item struct {
+				Path string `json:"path"`
+			} `json:"item"`
+		} `json:"changeEntries"`
+	}
+	if err := c.get(changesURL, &changes); err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(changes.ChangeEntries))
+	for _, e := range changes.ChangeEntries {
+		files = append(files, e.Item.Path)
+	}
+	return files, nil
+}
+
+// GetPullRequest fetches a single pull request by ID.
+func (c *AzureDevOpsClient) GetPullRequest(repo string, number int) (*scm.PullRequest, error) {
+	url := fmt.Sprintf("%s/%s/_apis/git/repositories/%s/pullRequests/%d?api-version=6.0", c.BaseURL, c.Project, repo, number)
+	var ar azurePullRequest
+	if err := c.get(url, &ar); err != nil {
+		return nil, err
+	}
+	return ar.toSCM(), nil
+}
+
+// SetStatus posts a commit status on the pull request's source commit.
+func (c *AzureDevOpsClient) SetStatus(repo, sha string, status *scm.Status) error {
+	url := fmt.Sprintf("%s/%s/_apis/git/repositories/%s/commits/%s/statuses?api-version=6.0", c.BaseURL, c.Project, repo, sha)
+	body, err := json.Marshal(map[string]interface{}{
+		"state":       azureStatusState(status.State),
+		"description": status.Desc,
+		"targetUrl":   status.Target,
+		"context":     map[string]string{"name": status.Label, "genre": "lighthouse"},
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshalling status")
+	}
+	return c.do(http.MethodPost, url, body)
+}
+
+// ListReviewers lists the reviewers currently assigned to a pull request.
+func (c *AzureDevOpsClient) ListReviewers(repo string, number int) ([]scm.User, error) {
+	url := fmt.Sprintf("%s/%s/_apis/git/repositories/%s/pullRequests/%d/reviewers?api-version=6.0", c.BaseURL, c.Project, repo, number)
+	var resp struct {
+		Value []struct {
+			DisplayName string `json:"displayName"`
+			UniqueName  string `json:"uniqueName"`
+		} `json:"value"`
+	}
+	if err := c.get(url, &resp); err != nil {
+		return nil, err
+	}
+	reviewers := make([]scm.User, 0, len(resp.Value))
+	for _, r := range resp.Value {
+		reviewers = append(reviewers, scm.User{Login: r.UniqueName, Name: r.DisplayName})
+	}
+	return reviewers, nil
+}
+
+func (c *AzureDevOpsClient) get(url string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	c.authenticate(req)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "calling %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("azure devops request to %s failed with status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *AzureDevOpsClient) do(method, url string, body []byte) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.authenticate(req)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "calling %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("azure devops request to %s failed with status %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *AzureDevOpsClient) authenticate(req *http.Request) {
+	token := base64.StdEncoding.EncodeToString([]byte(":" + c.PersonalAccessToken))
+	req.Header.Set("Authorization", "Basic "+token)
+}
+
+// VerifyBasicAuth checks an incoming Azure DevOps Service Hooks request against the
+// username/password configured on the subscription. Azure's webhook model has no HMAC
+// signature like GitHub's; it authenticates deliveries with HTTP basic auth instead.
+func VerifyBasicAuth(r *http.Request, username, password string) bool {
+	gotUser, gotPass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(gotUser), []byte(username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(gotPass), []byte(password)) == 1
+	return userOK && passOK
+}
+
+// azurePush is the subset of Azure's git.push payload lighthouse needs.
+type azurePush struct {
+	Resource struct {
+		RefUpdates []struct {
+			Name        string `json:"name"`
+			NewObjectID string `json:"newObjectId"`
+			OldObjectID string `json:"oldObjectId"`
+		} `json:"refUpdates"`
+		Repository azureRepository `json:"repository"`
+		PushedBy   azureIdentity   `json:"pushedBy"`
+	} `json:"resource"`
+}
+
+// TranslatePushEvent converts an Azure DevOps git.push payload into the scm.PushHook every
+// push plugin already consumes.
+func TranslatePushEvent(payload []byte) (*scm.PushHook, error) {
+	var p azurePush
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, errors.Wrap(err, "decoding azure git.push payload")
+	}
+	if len(p.Resource.RefUpdates) == 0 {
+		return nil, fmt.Errorf("azure git.push payload has no refUpdates")
+	}
+	ref := p.Resource.RefUpdates[0]
+	return &scm.PushHook{
+		Ref:    ref.Name,
+		Before: ref.OldObjectID,
+		After:  ref.NewObjectID,
+		Repo:   p.Resource.Repository.toSCM(),
+		Sender: p.Resource.PushedBy.toSCM(),
+	}, nil
+}
+
+// azurePullRequest is the subset of Azure's pull request resource lighthouse needs, shared by
+// the git.pullrequest.* event payloads and the GetPullRequest REST response.
+type azurePullRequest struct {
+	PullRequestID int             `json:"pullRequestId"`
+	Status        string          `json:"status"`      // "active", "completed", "abandoned"
+	MergeStatus   string          `json:"mergeStatus"` // "succeeded", "conflicts", "failed", "queued"
+	Title         string          `json:"title"`
+	Description   string          `json:"description"`
+	SourceRefName string          `json:"sourceRefName"`
+	TargetRefName string          `json:"targetRefName"`
+	Repository    azureRepository `json:"repository"`
+	CreatedBy     azureIdentity   `json:"createdBy"`
+}
+
+func (pr azurePullRequest) toSCM() *scm.PullRequest {
+	return &scm.PullRequest{
+		Number: pr.PullRequestID,
+		Title:  pr.Title,
+		Body:   pr.Description,
+		Source: strings.TrimPrefix(pr.SourceRefName, "refs/heads/"),
+		Target: strings.TrimPrefix(pr.TargetRefName, "refs/heads/"),
+		Author: pr.CreatedBy.toSCM(),
+		Closed: pr.Status != "active",
+		Merged: pr.Status == "completed" && pr.MergeStatus == "succeeded",
+	}
+}
+
+type azurePullRequestEvent struct {
+	EventType string           `json:"eventType"`
+	Resource  azurePullRequest `json:"resource"`
+}
+
+// TranslatePullRequestEvent converts an Azure DevOps git.pullrequest.* payload into the
+// scm.PullRequestHook every PR plugin already consumes, mapping resource.status/mergeStatus
+// onto the scm.Action values actionRelatesToPullRequestComment already understands.
+func TranslatePullRequestEvent(payload []byte) (*scm.PullRequestHook, error) {
+	var e azurePullRequestEvent
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return nil, errors.Wrap(err, "decoding azure pull request payload")
+	}
+	return &scm.PullRequestHook{
+		Action:      azurePullRequestAction(e.EventType, e.Resource),
+		Repo:        e.Resource.Repository.toSCM(),
+		PullRequest: *e.Resource.toSCM(),
+	}, nil
+}
+
+// azurePullRequestAction maps an Azure eventType plus the PR's status/mergeStatus onto the
+// scm.Action values consumed by actionRelatesToPullRequestComment.
+func azurePullRequestAction(eventType string, pr azurePullRequest) scm.Action {
+	switch eventType {
+	case AzureEventPullRequestCreated:
+		return scm.ActionOpen
+	case AzureEventPullRequestMerged:
+		return scm.ActionClose
+	case AzureEventPullRequestUpdated:
+		switch pr.Status {
+		case "completed":
+			return scm.ActionClose
+		case "abandoned":
+			return scm.ActionClose
+		default:
+			return scm.ActionSync
+		}
+	default:
+		return scm.ActionSync
+	}
+}
+
+type azurePullRequestComment struct {
+	Resource struct {
+		Comment struct {
+			ID      int           `json:"id"`
+			Content string        `json:"content"`
+			Author  azureIdentity `json:"author"`
+		} `json:"comment"`
+		PullRequest azurePullRequest `json:"pullRequest"`
+	} `json:"resource"`
+}
+
+// TranslatePullRequestCommentEvent converts an Azure
+// ms.vss-code.git-pullrequest-comment-event payload into the scm.PullRequestCommentHook every
+// comment plugin already consumes.
+func TranslatePullRequestCommentEvent(payload []byte) (*scm.PullRequestCommentHook, error) {
+	var e azurePullRequestComment
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return nil, errors.Wrap(err, "decoding azure pull request comment payload")
+	}
+	return &scm.PullRequestCommentHook{
+		Action:      scm.ActionCreate,
+		Repo:        e.Resource.PullRequest.Repository.toSCM(),
+		PullRequest: *e.Resource.PullRequest.toSCM(),
+		Comment: scm.Comment{
+			ID:     e.Resource.Comment.ID,
+			Body:   e.Resource.Comment.Content,
+			Author: e.Resource.Comment.Author.toSCM(),
+		},
+	}, nil
+}
+
+type azureRepository struct {
+	Name    string `json:"name"`
+	Project struct {
+		Name string `json:"name"`
+	} `json:"project"`
+}
+
+func (r azureRepository) toSCM() scm.Repository {
+	return scm.Repository{
+		Namespace: r.Project.Name,
+		Name:      r.Name,
+		FullName:  r.Project.Name + "/" + r.Name,
+	}
+}
+
+type azureIdentity struct {
+	DisplayName string `json:"displayName"`
+	UniqueName  string `json:"uniqueName"`
+}
+
+func (i azureIdentity) toSCM() scm.User {
+	return scm.User{Login: i.UniqueName, Name: i.DisplayName}
+}
+
+func azureStatusState(s scm.State) string {
+	switch s {
+	case scm.StateSuccess:
+		return "succeeded"
+	case scm.StatePending, scm.StateRunning:
+		return "pending"
+	case scm.StateError, scm.StateFailure:
+		return "failed"
+	default:
+		return "notSet"
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitprovider
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+)
+
+func TestTranslatePushEvent(t *testing.T) {
+	payload := []byte(`{
+		"resource": {
+			"refUpdates": [{"name": "refs/heads/main", "newObjectId": "abc123", "oldObjectId": "def456"}],
+			"repository": {"name": "my-repo", "project": {"name": "my-project"}},
+			"pushedBy": {"displayName": "A Dev", "uniqueName": "a.dev@example.com"}
+		}
+	}`)
+
+	pe, err := TranslatePushEvent(payload)
+	if err != nil {
+		t.Fatalf("TranslatePushEvent: %v", err)
+	}
+	if pe.Ref != "refs/heads/main" || pe.After != "abc123" || pe.Before != "def456" {
+		t.Fatalf("unexpected push hook: %+v", pe)
+	}
+	if pe.Repo.Namespace != "my-project" || pe.Repo.Name != "my-repo" {
+		t.Fatalf("unexpected repo: %+v", pe.Repo)
+	}
+	if pe.Sender.Login != "a.dev@example.com" {
+		t.Fatalf("unexpected sender: %+v", pe.Sender)
+	}
+}
+
+func TestTranslatePushEventRejectsEmptyRefUpdates(t *testing.T) {
+	if _, err := TranslatePushEvent([]byte(`{"resource": {"refUpdates": []}}`)); err == nil {
+		t.Fatal("expected an error for a push payload with no refUpdates")
+	}
+}
+
+func TestTranslatePullRequestEventMapsActions(t *testing.T) {
+	base := `{
+		"eventType": %q,
+		"resource": {
+			"pullRequestId": 7,
+			"status": %q,
+			"mergeStatus": %q,
+			"sourceRefName": "refs/heads/feature",
+			"targetRefName": "refs/heads/main",
+			"repository": {"name": "my-repo", "project": {"name": "my-project"}},
+			"createdBy": {"displayName": "A Dev", "uniqueName": "a.dev@example.com"}
+		}
+	}`
+
+	cases := []struct {
+		name        string
+		eventType   string
+		status      string
+		mergeStatus string
+		wantAction  scm.Action
+	}{
+		{"created", AzureEventPullRequestCreated, "active", "", scm.ActionOpen},
+		{"merged", AzureEventPullRequestMerged, "completed", "succeeded", scm.ActionClose},
+		{"updated-active", AzureEventPullRequestUpdated, "active", "", scm.ActionSync},
+		{"updated-abandoned", AzureEventPullRequestUpdated, "abandoned", "", scm.ActionClose},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			payload := []byte(fmt.Sprintf(base, c.eventType, c.status, c.mergeStatus))
+			pr, err := TranslatePullRequestEvent(payload)
+			if err != nil {
+				t.Fatalf("TranslatePullRequestEvent: %v", err)
+			}
+			if pr.Action != c.wantAction {
+				t.Errorf("Action = %v, want %v", pr.Action, c.wantAction)
+			}
+			if pr.PullRequest.Number != 7 || pr.PullRequest.Source != "feature" || pr.PullRequest.Target != "main" {
+				t.Errorf("unexpected pull request: %+v", pr.PullRequest)
+			}
+		})
+	}
+}
+
+func TestTranslatePullRequestCommentEvent(t *testing.T) {
+	payload := []byte(`{
+		"resource": {
+			"comment": {"id": 3, "content": "looks good", "author": {"displayName": "A Dev", "uniqueName": "a.dev@example.com"}},
+			"pullRequest": {
+				"pullRequestId": 7,
+				"status": "active",
+				"sourceRefName": "refs/heads/feature",
+				"targetRefName": "refs/heads/main",
+				"repository": {"name": "my-repo", "project": {"name": "my-project"}},
+				"createdBy": {"displayName": "A Dev", "uniqueName": "a.dev@example.com"}
+			}
+		}
+	}`)
+
+	pc, err := TranslatePullRequestCommentEvent(payload)
+	if err != nil {
+		t.Fatalf("TranslatePullRequestCommentEvent: %v", err)
+	}
+	if pc.Comment.Body != "looks good" || pc.Comment.ID != 3 {
+		t.Fatalf("unexpected comment: %+v", pc.Comment)
+	}
+	if pc.PullRequest.Number != 7 {
+		t.Fatalf("unexpected pull request: %+v", pc.PullRequest)
+	}
+}
+
+func TestVerifyBasicAuth(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.SetBasicAuth("hook-user", "hook-pass")
+
+	if !VerifyBasicAuth(req, "hook-user", "hook-pass") {
+		t.Error("expected matching basic auth credentials to verify")
+	}
+	if VerifyBasicAuth(req, "hook-user", "wrong-pass") {
+		t.Error("expected a wrong password to fail verification")
+	}
+
+	noAuth := httptest.NewRequest(http.MethodPost, "/", nil)
+	if VerifyBasicAuth(noAuth, "hook-user", "hook-pass") {
+		t.Error("expected a request with no basic auth header to fail verification")
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/jenkins-x/lighthouse/pkg/prow/gitprovider"
+)
+
+// AzureWebhookHandler serves Azure DevOps Service Hooks deliveries: it verifies them with HTTP
+// basic auth (Azure has no HMAC signature scheme like GitHub's) and translates each payload
+// with the matching gitprovider.Translate*Event function into the same scm.*Hook types every
+// other provider's intake produces, so it can feed them straight into Server's existing
+// Handle*Event methods.
+type AzureWebhookHandler struct {
+	Server *Server
+	// Username and Password authenticate the Azure DevOps Service Hooks subscription; they
+	// must match what was configured when the subscription was created.
+	Username string
+	Password string
+}
+
+// NewAzureWebhookHandler creates an AzureWebhookHandler serving deliveries into server.
+func NewAzureWebhookHandler(server *Server, username, password string) *AzureWebhookHandler {
+	return &AzureWebhookHandler{Server: server, Username: username, Password: password}
+}
+
+// azureEventEnvelope is the `eventType` field every Azure DevOps Service Hooks payload shares,
+// read first so ServeHTTP knows which Translate*Event function to decode the body with.
+type azureEventEnvelope struct {
+	EventType string `json:"eventType"`
+}
+
+func (h *AzureWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !gitprovider.VerifyBasicAuth(r, h.Username, h.Password) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var envelope azureEventEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	l := logrus.WithField("azure-event-type", envelope.EventType)
+
+	switch envelope.EventType {
+	case gitprovider.AzureEventPush:
+		pe, err := gitprovider.TranslatePushEvent(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.Server.HandlePushEvent(l, pe)
+
+	case gitprovider.AzureEventPullRequestCreated, gitprovider.AzureEventPullRequestUpdated, gitprovider.AzureEventPullRequestMerged:
+		pr, err := gitprovider.TranslatePullRequestEvent(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.Server.HandlePullRequestEvent(l, pr)
+
+	case gitprovider.AzureEventPullRequestComment:
+		pc, err := gitprovider.TranslatePullRequestCommentEvent(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.Server.HandlePullRequestCommentEvent(l, *pc)
+
+	default:
+		l.Debug("Ignoring unrecognized Azure DevOps event type.")
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
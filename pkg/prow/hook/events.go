@@ -17,8 +17,10 @@ limitations under the License.
 package hook
 
 import (
+	"context"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/jenkins-x/go-scm/scm"
 	"github.com/jenkins-x/jx/pkg/jxfactory"
@@ -38,14 +40,41 @@ type Server struct {
 	TokenGenerator func() []byte
 	Metrics        *Metrics
 
+	// ExternalPlugins dispatches hook payloads to plugins running as separate processes,
+	// in addition to the in-process handlers registered with Plugins. May be nil.
+	ExternalPlugins *plugins.ExternalPluginManager
+
+	// PluginTimeout bounds a single in-process plugin call. Defaults to DefaultPluginTimeout.
+	PluginTimeout time.Duration
+	// PluginTimeouts overrides PluginTimeout for specific plugins by name. Populate it from
+	// plugins.yaml's `pluginTimeouts:` stanza with plugins.LoadPluginTimeouts.
+	PluginTimeouts map[string]time.Duration
+
+	// EventStore, if set, persists every webhook delivery before dispatch so it can be
+	// retried or redriven from the dead letter collection after a crash or plugin failure.
+	EventStore EventStore
+	// MaxPluginAttempts bounds how many times EventStore-backed retries are attempted for a
+	// single plugin before the event is moved to the dead letter collection. Defaults to
+	// DefaultMaxPluginAttempts.
+	MaxPluginAttempts int
+
 	// Tracks running handlers for graceful shutdown
 	wg sync.WaitGroup
+
+	ctxOnce        sync.Once
+	shutdownCtx    context.Context
+	shutdownCancel context.CancelFunc
+	shuttingDown   int32
 }
 
 const failedCommentCoerceFmt = "Could not coerce %s event to a GenericCommentEvent. Unknown 'action': %q."
 
 // HandleIssueCommentEvent handle comment events
 func (s *Server) HandleIssueCommentEvent(l *logrus.Entry, ic scm.IssueCommentHook) {
+	if s.isShuttingDown() {
+		l.Warn("Dropping IssueCommentEvent: server is shutting down.")
+		return
+	}
 	l = l.WithFields(logrus.Fields{
 		gitprovider.OrgLogField:  ic.Repo.Namespace,
 		gitprovider.RepoLogField: ic.Repo.Name,
@@ -54,7 +83,13 @@ func (s *Server) HandleIssueCommentEvent(l *logrus.Entry, ic scm.IssueCommentHoo
 		"url":                    ic.Comment.Link,
 	})
 	l.Infof("Issue comment %s.", ic.Action)
+	rawGUID := strconv.Itoa(ic.Comment.ID)
+	guid := eventStoreGUID(EventKindIssueComment, rawGUID)
+	s.persistEvent(EventKindIssueComment, ic.Repo.Namespace, ic.Repo.Name, guid, ic)
 	for p, h := range s.Plugins.IssueCommentHandlers(ic.Repo.Namespace, ic.Repo.Name) {
+		if !s.beginAttempt(guid, p) {
+			continue
+		}
 		s.wg.Add(1)
 		go func(p string, h plugins.IssueCommentHandler) {
 			defer s.wg.Done()
@@ -64,16 +99,22 @@ func (s *Server) HandleIssueCommentEvent(l *logrus.Entry, ic scm.IssueCommentHoo
 				ic.Repo.Name,
 				ic.Issue.Number,
 			)
-			if err := h(agent, ic); err != nil {
-				agent.Logger.WithError(err).Error("Error handling IssueCommentEvent.")
-			}
+			ctxHandler := plugins.WithContextIssueComment(h)
+			s.runPlugin(agent.Logger, p, func(ctx context.Context) error {
+				err := ctxHandler(ctx, agent, ic)
+				s.markEventResult(guid, p, err)
+				return err
+			})
 		}(p, h)
 	}
+	if s.ExternalPlugins != nil {
+		s.ExternalPlugins.DispatchIssueComment(s.serverContext(), l, ic)
+	}
 
 	s.handleGenericComment(
 		l,
 		&gitprovider.GenericCommentEvent{
-			GUID:        strconv.Itoa(ic.Comment.ID),
+			GUID:        rawGUID,
 			IsPR:        ic.Issue.PullRequest,
 			Action:      ic.Action,
 			Body:        ic.Comment.Body,
@@ -122,7 +163,16 @@ func (s *Server) HandlePullRequestCommentEvent(l *logrus.Entry, pc scm.PullReque
 }
 
 func (s *Server) handleGenericComment(l *logrus.Entry, ce *gitprovider.GenericCommentEvent) {
+	if s.isShuttingDown() {
+		l.Warn("Dropping GenericCommentEvent: server is shutting down.")
+		return
+	}
+	guid := eventStoreGUID(EventKindGenericComment, ce.GUID)
+	s.persistEvent(EventKindGenericComment, ce.Repo.Namespace, ce.Repo.Name, guid, *ce)
 	for p, h := range s.Plugins.GenericCommentHandlers(ce.Repo.Namespace, ce.Repo.Name) {
+		if !s.beginAttempt(guid, p) {
+			continue
+		}
 		s.wg.Add(1)
 		go func(p string, h plugins.GenericCommentHandler) {
 			defer s.wg.Done()
@@ -132,15 +182,25 @@ func (s *Server) handleGenericComment(l *logrus.Entry, ce *gitprovider.GenericCo
 				ce.Repo.Name,
 				ce.Number,
 			)
-			if err := h(agent, *ce); err != nil {
-				agent.Logger.WithError(err).Error("Error handling GenericCommentEvent.")
-			}
+			ctxHandler := plugins.WithContextGenericComment(h)
+			s.runPlugin(agent.Logger, p, func(ctx context.Context) error {
+				err := ctxHandler(ctx, agent, *ce)
+				s.markEventResult(guid, p, err)
+				return err
+			})
 		}(p, h)
 	}
+	if s.ExternalPlugins != nil {
+		s.ExternalPlugins.DispatchGenericComment(s.serverContext(), l, *ce)
+	}
 }
 
 // HandlePushEvent handles a push event
 func (s *Server) HandlePushEvent(l *logrus.Entry, pe *scm.PushHook) {
+	if s.isShuttingDown() {
+		l.Warn("Dropping PushEvent: server is shutting down.")
+		return
+	}
 	repo := pe.Repository()
 	l = l.WithFields(logrus.Fields{
 		gitprovider.OrgLogField:  repo.Namespace,
@@ -149,23 +209,43 @@ func (s *Server) HandlePushEvent(l *logrus.Entry, pe *scm.PushHook) {
 		"head":                   pe.After,
 	})
 	l.Info("Push event.")
+	// rawGUID includes Ref, not just After (the head sha): two distinct deliveries can share
+	// a sha (push to two branches, force-push back to a prior commit), and pe.After alone
+	// would collide them into one idempotency key, silently marking the second "done" for
+	// plugins that never ran against it.
+	rawGUID := repo.Namespace + "/" + repo.Name + "/" + pe.Ref + "/" + pe.After
+	guid := eventStoreGUID(EventKindPush, rawGUID)
+	s.persistEvent(EventKindPush, repo.Namespace, repo.Name, guid, *pe)
 	c := 0
 	for p, h := range s.Plugins.PushEventHandlers(repo.Namespace, repo.Name) {
+		if !s.beginAttempt(guid, p) {
+			continue
+		}
 		s.wg.Add(1)
 		c++
 		go func(p string, h plugins.PushEventHandler) {
 			defer s.wg.Done()
 			agent := plugins.NewAgent(s.ClientFactory, s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", p))
-			if err := h(agent, *pe); err != nil {
-				agent.Logger.WithError(err).Error("Error handling PushEvent.")
-			}
+			ctxHandler := plugins.WithContextPushEvent(h)
+			s.runPlugin(agent.Logger, p, func(ctx context.Context) error {
+				err := ctxHandler(ctx, agent, *pe)
+				s.markEventResult(guid, p, err)
+				return err
+			})
 		}(p, h)
 	}
+	if s.ExternalPlugins != nil {
+		s.ExternalPlugins.DispatchPushEvent(s.serverContext(), l, *pe)
+	}
 	l.WithField("count", strconv.Itoa(c)).Info("number of push handlers")
 }
 
 // HandlePullRequestEvent handles a pull request event
 func (s *Server) HandlePullRequestEvent(l *logrus.Entry, pr *scm.PullRequestHook) {
+	if s.isShuttingDown() {
+		l.Warn("Dropping PullRequestEvent: server is shutting down.")
+		return
+	}
 	l = l.WithFields(logrus.Fields{
 		gitprovider.OrgLogField:  pr.Repo.Namespace,
 		gitprovider.RepoLogField: pr.Repo.Name,
@@ -180,7 +260,12 @@ func (s *Server) HandlePullRequestEvent(l *logrus.Entry, pr *scm.PullRequestHook
 	if repo.Name == "" {
 		repo = pr.Repo
 	}
+	guid := eventStoreGUID(EventKindPullRequest, pr.GUID)
+	s.persistEvent(EventKindPullRequest, repo.Namespace, repo.Name, guid, *pr)
 	for p, h := range s.Plugins.PullRequestHandlers(repo.Namespace, repo.Name) {
+		if !s.beginAttempt(guid, p) {
+			continue
+		}
 		s.wg.Add(1)
 		c++
 		go func(p string, h plugins.PullRequestHandler) {
@@ -191,11 +276,17 @@ func (s *Server) HandlePullRequestEvent(l *logrus.Entry, pr *scm.PullRequestHook
 				pr.Repo.Name,
 				pr.PullRequest.Number,
 			)
-			if err := h(agent, *pr); err != nil {
-				agent.Logger.WithError(err).Error("Error handling PullRequestEvent.")
-			}
+			ctxHandler := plugins.WithContextPullRequest(h)
+			s.runPlugin(agent.Logger, p, func(ctx context.Context) error {
+				err := ctxHandler(ctx, agent, *pr)
+				s.markEventResult(guid, p, err)
+				return err
+			})
 		}(p, h)
 	}
+	if s.ExternalPlugins != nil {
+		s.ExternalPlugins.DispatchPullRequestEvent(s.serverContext(), l, *pr)
+	}
 	l.WithField("count", strconv.Itoa(c)).Info("number of PR handlers")
 
 	if !actionRelatesToPullRequestComment(action, l) {
@@ -221,9 +312,48 @@ func (s *Server) HandlePullRequestEvent(l *logrus.Entry, pr *scm.PullRequestHook
 	)
 }
 
-// HandleBranchEvent handles a branch event
-func (s *Server) HandleBranchEvent(entry *logrus.Entry, hook *scm.BranchHook) {
-	// TODO
+// HandleBranchEvent handles a branch create/delete event
+func (s *Server) HandleBranchEvent(l *logrus.Entry, be *scm.BranchHook) {
+	if s.isShuttingDown() {
+		l.Warn("Dropping BranchEvent: server is shutting down.")
+		return
+	}
+	repo := be.Repo
+	l = l.WithFields(logrus.Fields{
+		gitprovider.OrgLogField:  repo.Namespace,
+		gitprovider.RepoLogField: repo.Name,
+		"ref":                    be.Ref.Name,
+		"action":                 be.Action,
+	})
+	l.Info("Branch event.")
+	rawGUID := repo.Namespace + "/" + repo.Name + "/" + be.Ref.Name + "/" + string(be.Action)
+	guid := eventStoreGUID(EventKindBranch, rawGUID)
+	s.persistEvent(EventKindBranch, repo.Namespace, repo.Name, guid, *be)
+	c := 0
+	for p, h := range s.Plugins.BranchEventHandlers(repo.Namespace, repo.Name) {
+		if !s.beginAttempt(guid, p) {
+			continue
+		}
+		s.wg.Add(1)
+		c++
+		go func(p string, h plugins.BranchEventHandler) {
+			defer s.wg.Done()
+			agent := plugins.NewAgent(s.ClientFactory, s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", p))
+			ctxHandler := plugins.WithContextBranchEvent(h)
+			s.runPlugin(agent.Logger, p, func(ctx context.Context) error {
+				err := ctxHandler(ctx, agent, *be)
+				s.markEventResult(guid, p, err)
+				return err
+			})
+		}(p, h)
+	}
+	if s.ExternalPlugins != nil {
+		s.ExternalPlugins.DispatchBranchEvent(s.serverContext(), l, *be)
+	}
+	if s.Metrics != nil {
+		s.Metrics.BranchEvents.WithLabelValues(repo.Namespace, repo.Name, string(be.Action)).Inc()
+	}
+	l.WithField("count", strconv.Itoa(c)).Info("number of branch handlers")
 }
 
 func actionRelatesToPullRequestComment(action scm.Action, l *logrus.Entry) bool {
@@ -0,0 +1,340 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EventKind identifies which Handle* method a StoredEvent should be replayed through.
+type EventKind string
+
+// Event kinds persisted by EventStore, one per Server.Handle* method.
+const (
+	EventKindIssueComment   EventKind = "issue_comment"
+	EventKindGenericComment EventKind = "generic_comment"
+	EventKindPush           EventKind = "push"
+	EventKindPullRequest    EventKind = "pull_request"
+	EventKindBranch         EventKind = "branch"
+)
+
+// StoredEvent is the durable record of a single webhook delivery. It is persisted before
+// dispatch so a crash between accepting a webhook and finishing plugin dispatch does not lose
+// the delivery: on restart, any event without every plugin marked done is redriven.
+type StoredEvent struct {
+	// GUID is the store key eventStoreGUID derives from the event kind and a per-delivery ID
+	// (ic.Comment.ID, pr.GUID, org/repo/ref/sha for a push, ...), used as the idempotency key
+	// so replays don't re-run plugins that already succeeded.
+	GUID    string          `json:"guid"`
+	Kind    EventKind       `json:"kind"`
+	Org     string          `json:"org"`
+	Repo    string          `json:"repo"`
+	Payload json.RawMessage `json:"payload"`
+
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Done records, per plugin name, whether that plugin has already succeeded for this
+	// event. Plugins not yet in this map (or mapped to false) still need to run.
+	Done map[string]bool `json:"done"`
+	// Attempts counts delivery attempts per plugin, used to compute backoff and the
+	// max-retry cutoff that moves an event to the dead letter collection.
+	Attempts map[string]int `json:"attempts"`
+	// LastError is the most recent error from any plugin, kept for the admin endpoint.
+	LastError string `json:"lastError,omitempty"`
+	// LastAttempt records when each plugin was last tried, so the worker pool can back off
+	// exponentially between retries instead of hammering a failing plugin.
+	LastAttempt map[string]time.Time `json:"lastAttempt,omitempty"`
+	// InFlight records, per plugin name, whether a call is currently running. It closes the
+	// window between persistEvent (before dispatch) and MarkResult (after the call returns)
+	// during which Attempts/LastAttempt still show "never tried": without it, StartEventWorker
+	// polling mid-call would see Done=false, Attempts=0 and redrive the same plugin a second
+	// time concurrently with the still-running inline dispatch.
+	InFlight map[string]bool `json:"inFlight,omitempty"`
+}
+
+// EventStore persists the raw webhook payload plus delivery bookkeeping atomically, before
+// plugin dispatch, so deliveries survive a crash or restart. Implementations: an in-memory
+// store for dev (MemoryEventStore), and, in the full deployment, a Kubernetes CRD
+// (LighthouseEvent) or a SQL/Redis backend.
+type EventStore interface {
+	// Save persists ev, or updates it in place if ev.GUID already exists.
+	Save(ctx context.Context, ev *StoredEvent) error
+	// MarkResult records the outcome of running plugin against ev's GUID, incrementing its
+	// attempt count and, on success, marking it done so retries/replays skip it. It also
+	// clears the in-flight marker BeginAttempt set for plugin.
+	MarkResult(ctx context.Context, guid, plugin string, err error) error
+	// BeginAttempt reserves guid/plugin for the caller, so a concurrent caller (the inline
+	// dispatch goroutine in events.go and StartEventWorker's redrive both call this) cannot
+	// invoke the same plugin for the same event at the same time. ok is false if plugin is
+	// already done or already in-flight, in which case the caller must not invoke it.
+	BeginAttempt(ctx context.Context, guid, plugin string) (ok bool, err error)
+	// Pending returns every event that has not been moved to the dead letter collection,
+	// including events whose attempted plugins are all marked done; redrive skips plugins
+	// already marked done.
+	Pending(ctx context.Context) ([]*StoredEvent, error)
+	// MoveToDeadLetter removes ev from Pending and records it, with reason, for operator
+	// inspection and manual re-drive.
+	MoveToDeadLetter(ctx context.Context, guid, reason string) error
+	// DeadLetters returns events that exceeded Server.MaxPluginAttempts for at least one plugin.
+	DeadLetters(ctx context.Context) ([]*StoredEvent, error)
+	// Requeue clears an event's dead-letter status so the worker pool picks it up again.
+	Requeue(ctx context.Context, guid string) error
+}
+
+// MemoryEventStore is an EventStore backed by a process-local map. It is the default for
+// local development; it does not survive a pod restart, unlike the CRD or SQL/Redis backends.
+type MemoryEventStore struct {
+	mu         sync.Mutex
+	events     map[string]*StoredEvent
+	deadLetter map[string]*StoredEvent
+}
+
+// NewMemoryEventStore creates an empty MemoryEventStore.
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{
+		events:     map[string]*StoredEvent{},
+		deadLetter: map[string]*StoredEvent{},
+	}
+}
+
+// Save implements EventStore.
+func (m *MemoryEventStore) Save(_ context.Context, ev *StoredEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.events[ev.GUID]; ok {
+		ev.Done = existing.Done
+		ev.Attempts = existing.Attempts
+		ev.LastAttempt = existing.LastAttempt
+		ev.InFlight = existing.InFlight
+	}
+	if ev.Done == nil {
+		ev.Done = map[string]bool{}
+	}
+	if ev.Attempts == nil {
+		ev.Attempts = map[string]int{}
+	}
+	m.events[ev.GUID] = ev
+	return nil
+}
+
+// MarkResult implements EventStore.
+func (m *MemoryEventStore) MarkResult(_ context.Context, guid, plugin string, err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ev, ok := m.events[guid]
+	if !ok {
+		return fmt.Errorf("no stored event with GUID %q", guid)
+	}
+	ev.Attempts[plugin]++
+	if ev.LastAttempt == nil {
+		ev.LastAttempt = map[string]time.Time{}
+	}
+	ev.LastAttempt[plugin] = timeNow()
+	delete(ev.InFlight, plugin)
+	if err != nil {
+		ev.LastError = err.Error()
+		return nil
+	}
+	ev.Done[plugin] = true
+	return nil
+}
+
+// BeginAttempt implements EventStore.
+func (m *MemoryEventStore) BeginAttempt(_ context.Context, guid, plugin string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ev, ok := m.events[guid]
+	if !ok {
+		return false, fmt.Errorf("no stored event with GUID %q", guid)
+	}
+	if ev.Done[plugin] || ev.InFlight[plugin] {
+		return false, nil
+	}
+	if ev.InFlight == nil {
+		ev.InFlight = map[string]bool{}
+	}
+	ev.InFlight[plugin] = true
+	return true, nil
+}
+
+// timeNow is a var so tests can stub it; production code always uses time.Now.
+var timeNow = time.Now
+
+// Pending implements EventStore.
+func (m *MemoryEventStore) Pending(_ context.Context) ([]*StoredEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pending []*StoredEvent
+	for _, ev := range m.events {
+		pending = append(pending, ev)
+	}
+	return pending, nil
+}
+
+// MoveToDeadLetter implements EventStore.
+func (m *MemoryEventStore) MoveToDeadLetter(_ context.Context, guid, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ev, ok := m.events[guid]
+	if !ok {
+		return fmt.Errorf("no stored event with GUID %q", guid)
+	}
+	ev.LastError = reason
+	m.deadLetter[guid] = ev
+	delete(m.events, guid)
+	return nil
+}
+
+// DeadLetters implements EventStore.
+func (m *MemoryEventStore) DeadLetters(_ context.Context) ([]*StoredEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var dead []*StoredEvent
+	for _, ev := range m.deadLetter {
+		dead = append(dead, ev)
+	}
+	return dead, nil
+}
+
+// Requeue implements EventStore.
+func (m *MemoryEventStore) Requeue(_ context.Context, guid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ev, ok := m.deadLetter[guid]
+	if !ok {
+		return fmt.Errorf("no dead-lettered event with GUID %q", guid)
+	}
+	ev.Attempts = map[string]int{}
+	ev.LastError = ""
+	m.events[guid] = ev
+	delete(m.deadLetter, guid)
+	return nil
+}
+
+// eventStoreGUID derives the EventStore key for a delivery. The provider-issued GUID alone is
+// not unique across EventKinds: an issue comment's ID and the GenericCommentEvent handleGenericComment
+// builds from it share the same raw GUID, and without this prefix the second Save would silently
+// overwrite the first event's Kind/Payload in the map while carrying its Done/Attempts forward.
+func eventStoreGUID(kind EventKind, guid string) string {
+	return string(kind) + "/" + guid
+}
+
+// persistEvent saves a StoredEvent for the given kind/payload before dispatch, so a crash
+// between accepting the webhook and finishing plugin dispatch doesn't lose it. It is a no-op
+// if s.EventStore is unset, and logs (rather than fails) a marshal/save error so a broken
+// store never blocks delivery to in-process and external plugins.
+func (s *Server) persistEvent(kind EventKind, org, repo, guid string, payload interface{}) {
+	if s.EventStore == nil {
+		return
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		logrus.WithError(err).WithField("guid", guid).Error("Error marshalling event for the event store.")
+		return
+	}
+	ev := &StoredEvent{
+		GUID:      guid,
+		Kind:      kind,
+		Org:       org,
+		Repo:      repo,
+		Payload:   raw,
+		CreatedAt: timeNow(),
+	}
+	if err := s.EventStore.Save(context.Background(), ev); err != nil {
+		logrus.WithError(err).WithField("guid", guid).Error("Error persisting event to the event store.")
+	}
+}
+
+// markEventResult records the outcome of an inline (non-redrive) plugin call in s.EventStore,
+// if one is configured, so a later redrive knows not to repeat work that already succeeded.
+func (s *Server) markEventResult(guid, plugin string, err error) {
+	if s.EventStore == nil {
+		return
+	}
+	if markErr := s.EventStore.MarkResult(context.Background(), guid, plugin, err); markErr != nil {
+		logrus.WithError(markErr).WithField("guid", guid).Error("Error recording plugin result.")
+	}
+}
+
+// beginAttempt reserves guid/plugin for an inline dispatch call, before its goroutine is even
+// spawned, so StartEventWorker's redrive (which also calls EventStore.BeginAttempt) can never
+// invoke the same plugin concurrently with this call. It returns false if the caller must not
+// invoke the plugin (already done, or already in-flight via another caller); it always returns
+// true when no EventStore is configured, since there is nothing to race against.
+func (s *Server) beginAttempt(guid, plugin string) bool {
+	if s.EventStore == nil {
+		return true
+	}
+	ok, err := s.EventStore.BeginAttempt(context.Background(), guid, plugin)
+	if err != nil {
+		logrus.WithError(err).WithField("guid", guid).Error("Error reserving plugin attempt.")
+		return true
+	}
+	return ok
+}
+
+// DeadLetterHandler serves the dead-lettered events in s.EventStore as JSON, for operators to
+// inspect and decide what to re-drive. Returns 404 if no EventStore is configured.
+func (s *Server) DeadLetterHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.EventStore == nil {
+			http.NotFound(w, r)
+			return
+		}
+		dead, err := s.EventStore.DeadLetters(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(dead); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// RequeueHandler lets an operator re-drive a dead-lettered event by GUID (passed as the
+// "guid" query parameter), clearing its attempt count so the worker pool retries it.
+func (s *Server) RequeueHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.EventStore == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		guid := r.URL.Query().Get("guid")
+		if guid == "" {
+			http.Error(w, "missing guid query parameter", http.StatusBadRequest)
+			return
+		}
+		if err := s.EventStore.Requeue(r.Context(), guid); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
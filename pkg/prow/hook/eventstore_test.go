@@ -0,0 +1,161 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hook
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryEventStoreMarkResultIsIdempotentPerPlugin(t *testing.T) {
+	s := NewMemoryEventStore()
+	ctx := context.Background()
+	ev := &StoredEvent{GUID: "guid-1", Kind: EventKindPush}
+	if err := s.Save(ctx, ev); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if err := s.MarkResult(ctx, "guid-1", "plugin-a", errors.New("boom")); err != nil {
+		t.Fatalf("MarkResult (failure): %v", err)
+	}
+	pending, err := s.Pending(ctx)
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Done["plugin-a"] {
+		t.Fatalf("plugin-a should not be marked done after a failed attempt: %+v", pending)
+	}
+	if pending[0].Attempts["plugin-a"] != 1 {
+		t.Fatalf("Attempts[plugin-a] = %d, want 1", pending[0].Attempts["plugin-a"])
+	}
+
+	if err := s.MarkResult(ctx, "guid-1", "plugin-a", nil); err != nil {
+		t.Fatalf("MarkResult (success): %v", err)
+	}
+	pending, _ = s.Pending(ctx)
+	if !pending[0].Done["plugin-a"] {
+		t.Fatal("plugin-a should be marked done after a successful attempt")
+	}
+	if pending[0].Attempts["plugin-a"] != 2 {
+		t.Fatalf("Attempts[plugin-a] = %d, want 2 (retries still count)", pending[0].Attempts["plugin-a"])
+	}
+}
+
+// TestMemoryEventStoreSavePreservesProgressAcrossReplays is the collision case the GUID scheme
+// in events.go exists to avoid: Save must carry forward Done/Attempts for a GUID that is
+// genuinely the same delivery being persisted again (e.g. a redrive), not silently invent
+// progress for what should be a distinct event.
+func TestMemoryEventStoreSavePreservesProgressAcrossReplays(t *testing.T) {
+	s := NewMemoryEventStore()
+	ctx := context.Background()
+
+	first := &StoredEvent{GUID: "guid-1", Kind: EventKindPush}
+	if err := s.Save(ctx, first); err != nil {
+		t.Fatalf("Save (first): %v", err)
+	}
+	if err := s.MarkResult(ctx, "guid-1", "plugin-a", nil); err != nil {
+		t.Fatalf("MarkResult: %v", err)
+	}
+
+	replay := &StoredEvent{GUID: "guid-1", Kind: EventKindPush}
+	if err := s.Save(ctx, replay); err != nil {
+		t.Fatalf("Save (replay): %v", err)
+	}
+	if !replay.Done["plugin-a"] {
+		t.Fatal("replaying the same GUID should carry forward which plugins already succeeded")
+	}
+}
+
+func TestMemoryEventStoreDeadLetterAndRequeue(t *testing.T) {
+	s := NewMemoryEventStore()
+	ctx := context.Background()
+	if err := s.Save(ctx, &StoredEvent{GUID: "guid-1", Kind: EventKindPush}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if err := s.MoveToDeadLetter(ctx, "guid-1", "exceeded max attempts"); err != nil {
+		t.Fatalf("MoveToDeadLetter: %v", err)
+	}
+	pending, _ := s.Pending(ctx)
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending events after MoveToDeadLetter, got %d", len(pending))
+	}
+	dead, err := s.DeadLetters(ctx)
+	if err != nil || len(dead) != 1 {
+		t.Fatalf("DeadLetters: %v, %+v", err, dead)
+	}
+
+	if err := s.Requeue(ctx, "guid-1"); err != nil {
+		t.Fatalf("Requeue: %v", err)
+	}
+	pending, _ = s.Pending(ctx)
+	if len(pending) != 1 {
+		t.Fatalf("expected the event back in Pending after Requeue, got %d", len(pending))
+	}
+	if len(pending[0].Attempts) != 0 {
+		t.Fatalf("Requeue should reset Attempts, got %+v", pending[0].Attempts)
+	}
+}
+
+func TestMemoryEventStoreBeginAttemptGuardsConcurrentInvoke(t *testing.T) {
+	s := NewMemoryEventStore()
+	ctx := context.Background()
+	if err := s.Save(ctx, &StoredEvent{GUID: "guid-1", Kind: EventKindPush}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	ok, err := s.BeginAttempt(ctx, "guid-1", "plugin-a")
+	if err != nil {
+		t.Fatalf("BeginAttempt: %v", err)
+	}
+	if !ok {
+		t.Fatal("expected the first BeginAttempt to be granted")
+	}
+
+	if ok, err := s.BeginAttempt(ctx, "guid-1", "plugin-a"); err != nil || ok {
+		t.Fatalf("expected a concurrent BeginAttempt for the same plugin to be refused, got ok=%v err=%v", ok, err)
+	}
+
+	if err := s.MarkResult(ctx, "guid-1", "plugin-a", nil); err != nil {
+		t.Fatalf("MarkResult: %v", err)
+	}
+	if ok, err := s.BeginAttempt(ctx, "guid-1", "plugin-a"); err != nil || ok {
+		t.Fatalf("expected BeginAttempt to refuse a plugin already marked done, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestEventStoreGUIDPrefixAvoidsKindCollision(t *testing.T) {
+	if got := eventStoreGUID(EventKindIssueComment, "42"); got == eventStoreGUID(EventKindGenericComment, "42") {
+		t.Fatalf("expected different EventKinds to produce different store keys for the same raw GUID, both got %q", got)
+	}
+}
+
+func TestDefaultBackoffIsMonotonicAndCapped(t *testing.T) {
+	prev := time.Duration(0)
+	for attempt := 0; attempt < 20; attempt++ {
+		d := defaultBackoff(attempt)
+		if d < prev {
+			t.Fatalf("defaultBackoff(%d) = %v, want >= previous %v", attempt, d, prev)
+		}
+		if d > 10*time.Minute {
+			t.Fatalf("defaultBackoff(%d) = %v, want capped at 10m", attempt, d)
+		}
+		prev = d
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hook
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Metrics holds the prometheus metrics Server records while dispatching hook events.
+type Metrics struct {
+	// BranchEvents counts HandleBranchEvent deliveries, by org, repo and action.
+	BranchEvents *prometheus.CounterVec
+	// PluginTimeouts counts runPlugin calls that hit their deadline, by plugin name.
+	PluginTimeouts *prometheus.CounterVec
+	// PluginCancellations counts runPlugin calls that stopped waiting because the server
+	// context was cancelled (e.g. Shutdown), by plugin name.
+	PluginCancellations *prometheus.CounterVec
+	// DeadLetteredEvents counts events redrive moved to the dead letter collection after
+	// exhausting retries, by org, repo and event kind.
+	DeadLetteredEvents *prometheus.CounterVec
+}
+
+// NewMetrics creates and registers a Metrics with the default prometheus registry.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		BranchEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lighthouse_branch_events",
+			Help: "Number of branch create/delete events handled, by org, repo and action.",
+		}, []string{"org", "repo", "action"}),
+		PluginTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lighthouse_plugin_timeouts",
+			Help: "Number of plugin calls that did not complete within their timeout, by plugin.",
+		}, []string{"plugin"}),
+		PluginCancellations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lighthouse_plugin_cancellations",
+			Help: "Number of plugin calls abandoned because the server context was cancelled, by plugin.",
+		}, []string{"plugin"}),
+		DeadLetteredEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "lighthouse_dead_lettered_events",
+			Help: "Number of events moved to the dead letter collection after exhausting retries, by org, repo and kind.",
+		}, []string{"org", "repo", "kind"}),
+	}
+	prometheus.MustRegister(
+		m.BranchEvents,
+		m.PluginTimeouts,
+		m.PluginCancellations,
+		m.DeadLetteredEvents,
+	)
+	return m
+}
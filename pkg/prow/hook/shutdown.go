@@ -0,0 +1,131 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hook
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPluginTimeout bounds a single in-process plugin call when Server.PluginTimeout is
+// unset. It can be overridden per-server, and is configurable in plugins.yaml.
+const DefaultPluginTimeout = 10 * time.Minute
+
+var errShuttingDown = fmt.Errorf("server is shutting down")
+
+// serverContext returns the context threaded into every handler goroutine, creating it (and
+// the shutdownCancel it pairs with) on first use.
+func (s *Server) serverContext() context.Context {
+	s.ctxOnce.Do(func() {
+		s.shutdownCtx, s.shutdownCancel = context.WithCancel(context.Background())
+	})
+	return s.shutdownCtx
+}
+
+// Shutdown stops the server accepting new hook deliveries, waits for in-flight plugin
+// handlers to finish (up to ctx's deadline), and then cancels the server-scoped context
+// passed to every handler goroutine. It returns ctx.Err() if the deadline is hit before all
+// handlers drain.
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if cancel := s.shutdownCancelFunc(); cancel != nil {
+		cancel()
+	}
+	return err
+}
+
+func (s *Server) shutdownCancelFunc() context.CancelFunc {
+	s.ctxOnce.Do(func() {
+		s.shutdownCtx, s.shutdownCancel = context.WithCancel(context.Background())
+	})
+	return s.shutdownCancel
+}
+
+func (s *Server) isShuttingDown() bool {
+	return atomic.LoadInt32(&s.shuttingDown) == 1
+}
+
+// pluginTimeout returns how long runPlugin waits for name before giving up on it, preferring a
+// per-plugin override from PluginTimeouts (populated from plugins.yaml's `pluginTimeouts:`
+// stanza via plugins.LoadPluginTimeouts) over the server-wide PluginTimeout, and falling back
+// to DefaultPluginTimeout if neither is set.
+func (s *Server) pluginTimeout(name string) time.Duration {
+	if d, ok := s.PluginTimeouts[name]; ok && d > 0 {
+		return d
+	}
+	if s.PluginTimeout > 0 {
+		return s.PluginTimeout
+	}
+	return DefaultPluginTimeout
+}
+
+// runPlugin invokes fn (a single context-aware plugin handler call) with a context derived
+// from serverContext(), bounded by pluginTimeout(name) and isolated from panics. fn is
+// responsible for passing callCtx into the plugin itself (see the WithContext* shims in
+// pkg/prow/plugins) so a context-aware plugin can observe cancellation directly; a legacy,
+// non-context-aware plugin wrapped by one of those shims still has no way to stop once
+// started, so Server merely stops waiting on it for shutdown/metrics purposes once callCtx
+// expires.
+func (s *Server) runPlugin(l *logrus.Entry, name string, fn func(context.Context) error) {
+	callCtx, cancel := context.WithTimeout(s.serverContext(), s.pluginTimeout(name))
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("plugin %q panicked: %v", name, r)
+			}
+		}()
+		done <- fn(callCtx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			l.WithError(err).Error("Error handling event.")
+		}
+	case <-callCtx.Done():
+		if s.Metrics != nil {
+			if callCtx.Err() == context.DeadlineExceeded {
+				s.Metrics.PluginTimeouts.WithLabelValues(name).Inc()
+			} else {
+				s.Metrics.PluginCancellations.WithLabelValues(name).Inc()
+			}
+		}
+		l.WithField("plugin", name).WithError(callCtx.Err()).Warn("Plugin call did not complete in time.")
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jenkins-x/lighthouse/pkg/prow/gitprovider"
+	"github.com/jenkins-x/lighthouse/pkg/prow/plugins"
+)
+
+// DefaultMaxPluginAttempts bounds how many times the worker pool retries a single plugin for
+// one event before moving it to the dead letter collection.
+const DefaultMaxPluginAttempts = 5
+
+// defaultBackoff is the exponential backoff applied between retries of a failing plugin,
+// capped so a long-broken plugin doesn't get starved out entirely.
+func defaultBackoff(attempt int) time.Duration {
+	d := time.Second << uint(attempt)
+	if max := 10 * time.Minute; d > max {
+		return max
+	}
+	return d
+}
+
+func (s *Server) maxPluginAttempts() int {
+	if s.MaxPluginAttempts > 0 {
+		return s.MaxPluginAttempts
+	}
+	return DefaultMaxPluginAttempts
+}
+
+// StartEventWorker runs the worker pool that drains s.EventStore: on each tick it re-invokes
+// any plugin that has not yet succeeded for a pending event, applying exponential backoff
+// between attempts, and moves events whose plugins exceed maxPluginAttempts to the dead
+// letter collection. It blocks until ctx is cancelled, so callers should run it in a
+// goroutine; it is a no-op if s.EventStore is nil.
+func (s *Server) StartEventWorker(ctx context.Context, interval time.Duration) {
+	if s.EventStore == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.drainEventStore(ctx)
+		}
+	}
+}
+
+func (s *Server) drainEventStore(ctx context.Context) {
+	pending, err := s.EventStore.Pending(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("Error listing pending events.")
+		return
+	}
+	for _, ev := range pending {
+		s.redrive(ctx, ev)
+	}
+}
+
+// redrive retries every plugin handler for ev that has not yet succeeded, honoring backoff and
+// the max-attempt dead-letter cutoff. GUID-based idempotency (ev.Done) means a plugin that
+// already succeeded is never re-run.
+func (s *Server) redrive(ctx context.Context, ev *StoredEvent) {
+	l := logrus.WithFields(logrus.Fields{"guid": ev.GUID, "kind": string(ev.Kind), "org": ev.Org, "repo": ev.Repo})
+
+	handlers, err := s.handlersForRedrive(l, ev)
+	if err != nil {
+		l.WithError(err).Error("Error decoding stored event for redrive.")
+		return
+	}
+
+	for name, invoke := range handlers {
+		if ev.Done[name] {
+			continue
+		}
+		attempts := ev.Attempts[name]
+		if attempts >= s.maxPluginAttempts() {
+			if err := s.EventStore.MoveToDeadLetter(ctx, ev.GUID, "exceeded max attempts for plugin "+name); err != nil {
+				l.WithError(err).Error("Error moving event to dead letter collection.")
+			}
+			if s.Metrics != nil {
+				s.Metrics.DeadLetteredEvents.WithLabelValues(ev.Org, ev.Repo, string(ev.Kind)).Inc()
+			}
+			return
+		}
+		if last, ok := ev.LastAttempt[name]; ok && time.Since(last) < defaultBackoff(attempts) {
+			continue
+		}
+		// BeginAttempt closes the race this redrive loop would otherwise have with the
+		// inline dispatch goroutines in events.go: without it, a tick landing while the
+		// original call for this event is still running would see Done=false, Attempts
+		// unchanged, and invoke the same plugin a second time concurrently.
+		ok, err := s.EventStore.BeginAttempt(ctx, ev.GUID, name)
+		if err != nil {
+			l.WithError(err).WithField("plugin", name).Error("Error reserving plugin attempt for redrive.")
+			continue
+		}
+		if !ok {
+			continue
+		}
+		err = invoke()
+		if markErr := s.EventStore.MarkResult(ctx, ev.GUID, name, err); markErr != nil {
+			l.WithError(markErr).Error("Error recording plugin result.")
+		}
+		if err != nil {
+			l.WithError(err).WithField("plugin", name).Warn("Plugin failed, will retry.")
+		}
+	}
+}
+
+// handlersForRedrive decodes ev.Payload back into its original hook type and returns, for
+// every plugin registered for ev.Org/ev.Repo, a closure that re-invokes just that plugin.
+func (s *Server) handlersForRedrive(l *logrus.Entry, ev *StoredEvent) (map[string]func() error, error) {
+	handlers := map[string]func() error{}
+	switch ev.Kind {
+	case EventKindIssueComment:
+		var ic scm.IssueCommentHook
+		if err := json.Unmarshal(ev.Payload, &ic); err != nil {
+			return nil, err
+		}
+		for name, h := range s.Plugins.IssueCommentHandlers(ev.Org, ev.Repo) {
+			h := h
+			handlers[name] = func() error {
+				agent := plugins.NewAgent(s.ClientFactory, s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", name))
+				return h(agent, ic)
+			}
+		}
+	case EventKindGenericComment:
+		var ce gitprovider.GenericCommentEvent
+		if err := json.Unmarshal(ev.Payload, &ce); err != nil {
+			return nil, err
+		}
+		for name, h := range s.Plugins.GenericCommentHandlers(ev.Org, ev.Repo) {
+			h := h
+			handlers[name] = func() error {
+				agent := plugins.NewAgent(s.ClientFactory, s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", name))
+				return h(agent, ce)
+			}
+		}
+	case EventKindPush:
+		var pe scm.PushHook
+		if err := json.Unmarshal(ev.Payload, &pe); err != nil {
+			return nil, err
+		}
+		for name, h := range s.Plugins.PushEventHandlers(ev.Org, ev.Repo) {
+			h := h
+			handlers[name] = func() error {
+				agent := plugins.NewAgent(s.ClientFactory, s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", name))
+				return h(agent, pe)
+			}
+		}
+	case EventKindPullRequest:
+		var pr scm.PullRequestHook
+		if err := json.Unmarshal(ev.Payload, &pr); err != nil {
+			return nil, err
+		}
+		for name, h := range s.Plugins.PullRequestHandlers(ev.Org, ev.Repo) {
+			h := h
+			handlers[name] = func() error {
+				agent := plugins.NewAgent(s.ClientFactory, s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", name))
+				return h(agent, pr)
+			}
+		}
+	case EventKindBranch:
+		var be scm.BranchHook
+		if err := json.Unmarshal(ev.Payload, &be); err != nil {
+			return nil, err
+		}
+		for name, h := range s.Plugins.BranchEventHandlers(ev.Org, ev.Repo) {
+			h := h
+			handlers[name] = func() error {
+				agent := plugins.NewAgent(s.ClientFactory, s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", name))
+				return h(agent, be)
+			}
+		}
+	}
+	return handlers, nil
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import "github.com/jenkins-x/go-scm/scm"
+
+// BranchEventHandler defines the function contract for plugins that react to branch
+// create/delete events, mirroring PushEventHandler.
+type BranchEventHandler func(Agent, scm.BranchHook) error
+
+// BranchEventHandlers returns the handlers registered for branch events on org/repo.
+func (pa *ConfigAgent) BranchEventHandlers(org, repo string) map[string]BranchEventHandler {
+	pa.mut.Lock()
+	defer pa.mut.Unlock()
+
+	hs := map[string]BranchEventHandler{}
+	for _, p := range pa.getPlugins(org, repo) {
+		if h, ok := branchEventHandlers[p]; ok {
+			hs[p] = h
+		}
+	}
+	return hs
+}
+
+var branchEventHandlers = map[string]BranchEventHandler{}
+
+// RegisterBranchEventHandler registers a plugin's BranchEventHandler under name, for use by
+// ConfigAgent.BranchEventHandlers.
+func RegisterBranchEventHandler(name string, fn BranchEventHandler) {
+	branchEventHandlers[name] = fn
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import (
+	"testing"
+
+	"github.com/jenkins-x/go-scm/scm"
+)
+
+func TestRegisterBranchEventHandler(t *testing.T) {
+	name := "test-branch-plugin"
+	var fn BranchEventHandler = func(Agent, scm.BranchHook) error { return nil }
+
+	RegisterBranchEventHandler(name, fn)
+	defer delete(branchEventHandlers, name)
+
+	if _, ok := branchEventHandlers[name]; !ok {
+		t.Fatalf("expected RegisterBranchEventHandler to register %q in branchEventHandlers", name)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jenkins-x/go-scm/scm"
+
+	"github.com/jenkins-x/lighthouse/pkg/prow/gitprovider"
+)
+
+// Context-aware handler types. New plugins should implement these directly so they can
+// observe the hook Server's shutdown/timeout context; plugins still written against the
+// legacy, context-less handler types (IssueCommentHandler, GenericCommentHandler,
+// PushEventHandler, PullRequestHandler, BranchEventHandler) keep working unchanged by going
+// through the WithContext* shims below, at the cost of not being able to react to
+// cancellation themselves.
+type (
+	// IssueCommentHandlerWithContext is IssueCommentHandler plus a context.Context.
+	IssueCommentHandlerWithContext func(context.Context, Agent, scm.IssueCommentHook) error
+	// GenericCommentHandlerWithContext is GenericCommentHandler plus a context.Context.
+	GenericCommentHandlerWithContext func(context.Context, Agent, gitprovider.GenericCommentEvent) error
+	// PushEventHandlerWithContext is PushEventHandler plus a context.Context.
+	PushEventHandlerWithContext func(context.Context, Agent, scm.PushHook) error
+	// PullRequestHandlerWithContext is PullRequestHandler plus a context.Context.
+	PullRequestHandlerWithContext func(context.Context, Agent, scm.PullRequestHook) error
+	// BranchEventHandlerWithContext is BranchEventHandler plus a context.Context.
+	BranchEventHandlerWithContext func(context.Context, Agent, scm.BranchHook) error
+)
+
+// WithContextIssueComment shims a legacy IssueCommentHandler into the context-aware type. The
+// shim itself cannot make the legacy handler observe cancellation; it only lets callers treat
+// every plugin uniformly while the ecosystem migrates.
+func WithContextIssueComment(h IssueCommentHandler) IssueCommentHandlerWithContext {
+	return func(_ context.Context, agent Agent, ic scm.IssueCommentHook) error { return h(agent, ic) }
+}
+
+// WithContextGenericComment shims a legacy GenericCommentHandler into the context-aware type.
+func WithContextGenericComment(h GenericCommentHandler) GenericCommentHandlerWithContext {
+	return func(_ context.Context, agent Agent, ce gitprovider.GenericCommentEvent) error { return h(agent, ce) }
+}
+
+// WithContextPushEvent shims a legacy PushEventHandler into the context-aware type.
+func WithContextPushEvent(h PushEventHandler) PushEventHandlerWithContext {
+	return func(_ context.Context, agent Agent, pe scm.PushHook) error { return h(agent, pe) }
+}
+
+// WithContextPullRequest shims a legacy PullRequestHandler into the context-aware type.
+func WithContextPullRequest(h PullRequestHandler) PullRequestHandlerWithContext {
+	return func(_ context.Context, agent Agent, pr scm.PullRequestHook) error { return h(agent, pr) }
+}
+
+// WithContextBranchEvent shims a legacy BranchEventHandler into the context-aware type.
+func WithContextBranchEvent(h BranchEventHandler) BranchEventHandlerWithContext {
+	return func(_ context.Context, agent Agent, be scm.BranchHook) error { return h(agent, be) }
+}
+
+// Duration unmarshals a plugins.yaml duration string (e.g. "10m") the same way
+// metav1.Duration does, since time.Duration itself only unmarshals from a number of
+// nanoseconds.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// pluginTimeoutsConfig is the `pluginTimeouts:` stanza of plugins.yaml: a per-plugin-name
+// override of how long Server.runPlugin waits before treating a call as timed out.
+type pluginTimeoutsConfig struct {
+	PluginTimeouts map[string]Duration `json:"pluginTimeouts"`
+}
+
+// LoadPluginTimeouts parses the `pluginTimeouts:` stanza of plugins.yaml into a plain
+// map[string]time.Duration Server.PluginTimeouts can be set from directly. The input is decoded
+// with encoding/json, so plugins.yaml must be written in JSON form; YAML block syntax is
+// rejected with an error.
+func LoadPluginTimeouts(pluginsYAML []byte) (map[string]time.Duration, error) {
+	var cfg pluginTimeoutsConfig
+	if err := json.Unmarshal(pluginsYAML, &cfg); err != nil {
+		return nil, err
+	}
+	timeouts := make(map[string]time.Duration, len(cfg.PluginTimeouts))
+	for name, d := range cfg.PluginTimeouts {
+		timeouts[name] = d.Duration
+	}
+	return timeouts, nil
+}
@@ -0,0 +1,410 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"github.com/jenkins-x/lighthouse/pkg/prow/gitprovider"
+	"github.com/jenkins-x/lighthouse/pkg/prow/plugins/externalplugin"
+)
+
+// Hook event names an external plugin can subscribe to in its ExternalPluginConfig.Events list.
+// These mirror the handler kinds already dispatched in-process by pkg/prow/hook.Server.
+const (
+	ExternalEventIssueComment   = "issue_comment"
+	ExternalEventGenericComment = "generic_comment"
+	ExternalEventPush           = "push"
+	ExternalEventPullRequest    = "pull_request"
+	ExternalEventBranch         = "branch"
+)
+
+// externalPluginDefaultTimeout bounds a single call to an external plugin when the plugin's
+// own config does not set one.
+const externalPluginDefaultTimeout = 5 * time.Minute
+
+// ExternalPluginConfig declares a plugin that runs as a separate process, outside the
+// lighthouse binary, and is invoked over gRPC (see pkg/prow/plugins/externalplugin) rather
+// than being linked in. It is populated from the `externalPlugins:` stanza of plugins.yaml by
+// LoadExternalPluginConfigs.
+type ExternalPluginConfig struct {
+	// Name identifies the plugin in logs and in the socket directory it is given.
+	Name string `json:"name"`
+	// Command is the binary to execute. It is looked up on PATH if not absolute.
+	Command string `json:"command"`
+	// Args are passed to Command on startup.
+	Args []string `json:"args,omitempty"`
+	// Env are additional environment variables set on the plugin process.
+	Env []string `json:"env,omitempty"`
+	// Dir is the working directory the plugin is started in.
+	Dir string `json:"dir,omitempty"`
+	// Events lists the hook events the plugin wants delivered to it, e.g. ExternalEventPush.
+	Events []string `json:"events"`
+	// Repos restricts delivery to "org" or "org/repo" entries. An empty list matches every
+	// repo lighthouse serves. The callback server does not check requests against Repos.
+	Repos []string `json:"repos,omitempty"`
+	// Timeout bounds a single call to the plugin. Defaults to externalPluginDefaultTimeout.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// externalPluginsConfig is the `externalPlugins:` stanza of plugins.yaml.
+type externalPluginsConfig struct {
+	ExternalPlugins []ExternalPluginConfig `json:"externalPlugins"`
+}
+
+// LoadExternalPluginConfigs parses the `externalPlugins:` stanza of plugins.yaml. The result
+// is what NewExternalPluginManager expects, and is the config knob that actually declares a
+// plugin: nothing else in plugins.yaml reaches ExternalPluginConfig. The input is decoded with
+// encoding/json, so plugins.yaml must be written in JSON form; YAML block syntax is rejected
+// with an error.
+func LoadExternalPluginConfigs(pluginsYAML []byte) ([]ExternalPluginConfig, error) {
+	var cfg externalPluginsConfig
+	if err := json.Unmarshal(pluginsYAML, &cfg); err != nil {
+		return nil, errors.Wrap(err, "parsing externalPlugins config")
+	}
+	return cfg.ExternalPlugins, nil
+}
+
+func (c ExternalPluginConfig) handlesEvent(event string) bool {
+	for _, e := range c.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (c ExternalPluginConfig) handlesRepo(org, repo string) bool {
+	if len(c.Repos) == 0 {
+		return true
+	}
+	for _, r := range c.Repos {
+		if r == org || r == org+"/"+repo {
+			return true
+		}
+	}
+	return false
+}
+
+func (c ExternalPluginConfig) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return externalPluginDefaultTimeout
+}
+
+// PluginAgent is the capability-scoped handle an external plugin's callback requests are
+// executed on behalf of. Unlike Agent (used by in-process plugins) it never exposes the
+// jxfactory: only a logger, the plugin's own config subset and an SCM client proxy limited
+// to the operations external plugins are allowed to perform. ExternalPluginManager constructs
+// one per configured plugin and hands it to that plugin's scmCallbackService.
+type PluginAgent struct {
+	Logger *logrus.Entry
+	Config ExternalPluginConfig
+	SCM    SCMCallbackProxy
+}
+
+// SCMCallbackProxy is the subset of SCM/git operations an external plugin may call back into
+// the host process for. It is intentionally narrower than scm.Client.
+type SCMCallbackProxy interface {
+	CreateComment(org, repo string, number int, isPR bool, comment string) error
+	AddLabel(org, repo string, number int, label string) error
+	RemoveLabel(org, repo string, number int, label string) error
+}
+
+// ExternalPluginManager launches and supervises external plugin processes declared via
+// ExternalPluginConfig and dispatches hook payloads to them over gRPC (see
+// pkg/prow/plugins/externalplugin for the service contract). It is the host-side plugin
+// manager: remote plugins never see the full jxfactory, only the PluginAgent handed to their
+// callback server.
+type ExternalPluginManager struct {
+	Configs []ExternalPluginConfig
+	// SCMClientFor returns the capability-scoped proxy callbacks for a given plugin should
+	// be executed against. Set by the caller that wires the manager into pkg/prow/hook.Server.
+	SCMClientFor func(c ExternalPluginConfig) SCMCallbackProxy
+
+	mu    sync.Mutex
+	procs map[string]*externalPluginProcess
+}
+
+type externalPluginProcess struct {
+	cmd     *exec.Cmd
+	conn    *grpc.ClientConn
+	client  externalplugin.ExternalPluginClient
+	sockDir string
+}
+
+// NewExternalPluginManager creates a manager for the given external plugin configs.
+func NewExternalPluginManager(configs []ExternalPluginConfig, scmClientFor func(c ExternalPluginConfig) SCMCallbackProxy) *ExternalPluginManager {
+	return &ExternalPluginManager{
+		Configs:      configs,
+		SCMClientFor: scmClientFor,
+		procs:        map[string]*externalPluginProcess{},
+	}
+}
+
+// ForEvent returns the plugins registered for the given event and repo.
+func (m *ExternalPluginManager) ForEvent(event, org, repo string) []ExternalPluginConfig {
+	var matched []ExternalPluginConfig
+	for _, c := range m.Configs {
+		if c.handlesEvent(event) && c.handlesRepo(org, repo) {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+// DispatchIssueComment calls every external plugin registered for ExternalEventIssueComment
+// on ic.Repo. Each call is panic-isolated and bounded by the plugin's configured timeout.
+func (m *ExternalPluginManager) DispatchIssueComment(ctx context.Context, l *logrus.Entry, ic scm.IssueCommentHook) {
+	m.dispatch(ctx, l, ExternalEventIssueComment, ic.Repo.Namespace, ic.Repo.Name, ic)
+}
+
+// DispatchGenericComment calls every external plugin registered for ExternalEventGenericComment
+// on ce.Repo.
+func (m *ExternalPluginManager) DispatchGenericComment(ctx context.Context, l *logrus.Entry, ce gitprovider.GenericCommentEvent) {
+	m.dispatch(ctx, l, ExternalEventGenericComment, ce.Repo.Namespace, ce.Repo.Name, ce)
+}
+
+// DispatchPushEvent calls every external plugin registered for ExternalEventPush on the
+// pushed-to repo.
+func (m *ExternalPluginManager) DispatchPushEvent(ctx context.Context, l *logrus.Entry, pe scm.PushHook) {
+	repo := pe.Repository()
+	m.dispatch(ctx, l, ExternalEventPush, repo.Namespace, repo.Name, pe)
+}
+
+// DispatchPullRequestEvent calls every external plugin registered for ExternalEventPullRequest
+// on pr.Repo.
+func (m *ExternalPluginManager) DispatchPullRequestEvent(ctx context.Context, l *logrus.Entry, pr scm.PullRequestHook) {
+	m.dispatch(ctx, l, ExternalEventPullRequest, pr.Repo.Namespace, pr.Repo.Name, pr)
+}
+
+// DispatchBranchEvent calls every external plugin registered for ExternalEventBranch on the
+// repo the branch was created in or deleted from.
+func (m *ExternalPluginManager) DispatchBranchEvent(ctx context.Context, l *logrus.Entry, bh scm.BranchHook) {
+	m.dispatch(ctx, l, ExternalEventBranch, bh.Repo.Namespace, bh.Repo.Name, bh)
+}
+
+func (m *ExternalPluginManager) dispatch(ctx context.Context, l *logrus.Entry, event, org, repo string, payload interface{}) {
+	for _, c := range m.ForEvent(event, org, repo) {
+		c := c
+		go func() {
+			pl := l.WithField("external-plugin", c.Name)
+			if err := m.call(ctx, c, event, org, repo, payload); err != nil {
+				pl.WithError(err).Error("Error calling external plugin.")
+			}
+		}()
+	}
+}
+
+// call invokes Handle on the plugin process for c, starting it on first use. It is bounded by
+// the plugin's configured timeout and recovers from panics inside the gRPC round trip so a
+// single misbehaving plugin cannot take down the hook server.
+func (m *ExternalPluginManager) call(ctx context.Context, c ExternalPluginConfig, event, org, repo string, payload interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("external plugin %q panicked: %v", c.Name, r)
+		}
+	}()
+
+	proc, err := m.processFor(c)
+	if err != nil {
+		return errors.Wrapf(err, "starting external plugin %q", c.Name)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrapf(err, "encoding payload for external plugin %q", c.Name)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, c.timeout())
+	defer cancel()
+
+	reply, err := proc.client.Handle(callCtx, &externalplugin.HookEvent{
+		Event:   event,
+		Org:     org,
+		Repo:    repo,
+		Payload: body,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "calling external plugin %q", c.Name)
+	}
+	if reply.Error != "" {
+		return fmt.Errorf("external plugin %q: %s", c.Name, reply.Error)
+	}
+	return nil
+}
+
+// processFor returns the running process for c, launching it if this is the first call.
+func (m *ExternalPluginManager) processFor(c ExternalPluginConfig) (*externalPluginProcess, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if proc, ok := m.procs[c.Name]; ok {
+		return proc, nil
+	}
+
+	sockDir, err := ioutil.TempDir("", "lighthouse-plugin-"+c.Name+"-")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating plugin socket dir")
+	}
+	sock := filepath.Join(sockDir, "plugin.sock")
+	callbackSock := filepath.Join(sockDir, "callback.sock")
+
+	if m.SCMClientFor != nil {
+		if err := m.serveCallback(callbackSock, c); err != nil {
+			return nil, errors.Wrap(err, "starting plugin callback listener")
+		}
+	}
+
+	cmd := exec.Command(c.Command, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Env = append(os.Environ(), c.Env...)
+	cmd.Env = append(cmd.Env,
+		"LIGHTHOUSE_PLUGIN_SOCK="+sock,
+		"LIGHTHOUSE_PLUGIN_CALLBACK_SOCK="+callbackSock,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "starting %q", c.Command)
+	}
+
+	conn, err := dialUnixWithRetry(sock, 10, 200*time.Millisecond)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		return nil, errors.Wrapf(err, "dialing plugin socket for %q", c.Name)
+	}
+
+	proc := &externalPluginProcess{
+		cmd:     cmd,
+		conn:    conn,
+		client:  externalplugin.NewExternalPluginClient(conn),
+		sockDir: sockDir,
+	}
+	m.procs[c.Name] = proc
+	return proc, nil
+}
+
+// serveCallback starts (in-process) the gRPC server an external plugin dials back into for
+// SCM operations, scoped to the capabilities of the PluginAgent built for c.
+func (m *ExternalPluginManager) serveCallback(sock string, c ExternalPluginConfig) error {
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		return err
+	}
+	agent := &PluginAgent{
+		Logger: logrus.WithField("external-plugin", c.Name),
+		Config: c,
+		SCM:    m.SCMClientFor(c),
+	}
+	server := grpc.NewServer(grpc.ForceServerCodec(jsonServerCodec{}))
+	externalplugin.RegisterSCMCallbackServer(server, &scmCallbackService{agent: agent})
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			agent.Logger.WithError(err).Error("External plugin callback server stopped.")
+		}
+	}()
+	return nil
+}
+
+type scmCallbackService struct {
+	agent *PluginAgent
+}
+
+// CreateComment lets an external plugin post a comment through the host's SCM client.
+func (s *scmCallbackService) CreateComment(_ context.Context, req *externalplugin.CreateCommentRequest) (*externalplugin.CreateCommentReply, error) {
+	if err := s.agent.SCM.CreateComment(req.Org, req.Repo, int(req.Number), req.IsPR, req.Comment); err != nil {
+		return nil, err
+	}
+	return &externalplugin.CreateCommentReply{}, nil
+}
+
+// AddLabel lets an external plugin add a label through the host's SCM client.
+func (s *scmCallbackService) AddLabel(_ context.Context, req *externalplugin.LabelRequest) (*externalplugin.LabelReply, error) {
+	if err := s.agent.SCM.AddLabel(req.Org, req.Repo, int(req.Number), req.Label); err != nil {
+		return nil, err
+	}
+	return &externalplugin.LabelReply{}, nil
+}
+
+// RemoveLabel lets an external plugin remove a label through the host's SCM client.
+func (s *scmCallbackService) RemoveLabel(_ context.Context, req *externalplugin.LabelRequest) (*externalplugin.LabelReply, error) {
+	if err := s.agent.SCM.RemoveLabel(req.Org, req.Repo, int(req.Number), req.Label); err != nil {
+		return nil, err
+	}
+	return &externalplugin.LabelReply{}, nil
+}
+
+// dialUnixWithRetry dials the unix socket a freshly-started plugin process listens on,
+// retrying while it finishes starting up, and returns a gRPC connection using the JSON codec
+// (see pkg/prow/plugins/externalplugin/jsoncodec.go).
+func dialUnixWithRetry(sock string, attempts int, interval time.Duration) (*grpc.ClientConn, error) {
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+	}
+
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		conn, err := grpc.DialContext(ctx, sock,
+			grpc.WithInsecure(),
+			grpc.WithBlock(),
+			grpc.WithContextDialer(dialer),
+			grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})),
+		)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		time.Sleep(interval)
+	}
+	return nil, lastErr
+}
+
+// jsonCodec and jsonServerCodec are defined in externalplugin so both the client dialed here
+// and the callback server above agree on the wire format; aliasing them locally keeps the
+// call sites in this file short.
+type jsonCodec = externalplugin.JSONCodec
+type jsonServerCodec = externalplugin.JSONCodec
+
+// Close stops every plugin process the manager started and removes their socket directories.
+func (m *ExternalPluginManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, proc := range m.procs {
+		_ = proc.conn.Close()
+		_ = proc.cmd.Process.Kill()
+		_ = os.RemoveAll(proc.sockDir)
+		delete(m.procs, name)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugins
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExternalPluginConfigHandlesEvent(t *testing.T) {
+	c := ExternalPluginConfig{Events: []string{ExternalEventPush, ExternalEventBranch}}
+	if !c.handlesEvent(ExternalEventPush) {
+		t.Error("expected config to handle its declared push event")
+	}
+	if c.handlesEvent(ExternalEventIssueComment) {
+		t.Error("expected config not to handle an event it did not declare")
+	}
+}
+
+func TestExternalPluginConfigHandlesRepo(t *testing.T) {
+	orgOnly := ExternalPluginConfig{Repos: []string{"my-org"}}
+	if !orgOnly.handlesRepo("my-org", "any-repo") {
+		t.Error("expected an org-level entry to match any repo in that org")
+	}
+	if orgOnly.handlesRepo("other-org", "any-repo") {
+		t.Error("expected an org-level entry not to match a different org")
+	}
+
+	scoped := ExternalPluginConfig{Repos: []string{"my-org/my-repo"}}
+	if !scoped.handlesRepo("my-org", "my-repo") {
+		t.Error("expected an org/repo entry to match that exact repo")
+	}
+	if scoped.handlesRepo("my-org", "other-repo") {
+		t.Error("expected an org/repo entry not to match a different repo in the same org")
+	}
+
+	unscoped := ExternalPluginConfig{}
+	if !unscoped.handlesRepo("any-org", "any-repo") {
+		t.Error("expected an empty Repos list to match every repo")
+	}
+}
+
+func TestExternalPluginConfigTimeout(t *testing.T) {
+	if got := (ExternalPluginConfig{}).timeout(); got != externalPluginDefaultTimeout {
+		t.Errorf("timeout() with no override = %v, want default %v", got, externalPluginDefaultTimeout)
+	}
+	configured := ExternalPluginConfig{Timeout: 30 * time.Second}
+	if got := configured.timeout(); got != 30*time.Second {
+		t.Errorf("timeout() with override = %v, want %v", got, 30*time.Second)
+	}
+}
+
+func TestLoadExternalPluginConfigs(t *testing.T) {
+	yaml := []byte(`{
+		"externalPlugins": [
+			{"name": "hello", "command": "hello-plugin", "events": ["push"], "repos": ["my-org"]}
+		]
+	}`)
+	configs, err := LoadExternalPluginConfigs(yaml)
+	if err != nil {
+		t.Fatalf("LoadExternalPluginConfigs: %v", err)
+	}
+	if len(configs) != 1 {
+		t.Fatalf("expected 1 config, got %d", len(configs))
+	}
+	if configs[0].Name != "hello" || configs[0].Command != "hello-plugin" {
+		t.Errorf("unexpected config: %+v", configs[0])
+	}
+	if !configs[0].handlesEvent(ExternalEventPush) {
+		t.Error("expected the parsed config to handle the push event it declared")
+	}
+}
+
+func TestForEventFiltersByEventAndRepo(t *testing.T) {
+	m := NewExternalPluginManager([]ExternalPluginConfig{
+		{Name: "push-only", Events: []string{ExternalEventPush}},
+		{Name: "scoped", Events: []string{ExternalEventPush}, Repos: []string{"other-org"}},
+	}, nil)
+
+	matched := m.ForEvent(ExternalEventPush, "my-org", "my-repo")
+	if len(matched) != 1 || matched[0].Name != "push-only" {
+		t.Fatalf("ForEvent matched %+v, want only push-only", matched)
+	}
+
+	if matched := m.ForEvent(ExternalEventBranch, "my-org", "my-repo"); len(matched) != 0 {
+		t.Fatalf("ForEvent matched %+v for an undeclared event, want none", matched)
+	}
+}
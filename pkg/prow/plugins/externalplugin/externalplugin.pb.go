@@ -0,0 +1,57 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package externalplugin holds the Go bindings for externalplugin.proto, the gRPC contract
+// lighthouse speaks to out-of-process plugins. The message types below mirror the .proto
+// definitions field-for-field; see jsoncodec.go for why the wire encoding is JSON rather than
+// protobuf binary.
+package externalplugin
+
+// HookEvent wraps one webhook payload for delivery to ExternalPlugin.Handle.
+type HookEvent struct {
+	Event   string `json:"event"`
+	Org     string `json:"org"`
+	Repo    string `json:"repo"`
+	Payload []byte `json:"payload"`
+}
+
+// HandleReply is ExternalPlugin.Handle's response.
+type HandleReply struct {
+	Error string `json:"error,omitempty"`
+}
+
+// CreateCommentRequest is SCMCallback.CreateComment's request.
+type CreateCommentRequest struct {
+	Org     string `json:"org"`
+	Repo    string `json:"repo"`
+	Number  int32  `json:"number"`
+	IsPR    bool   `json:"is_pr"`
+	Comment string `json:"comment"`
+}
+
+// CreateCommentReply is SCMCallback.CreateComment's (empty) response.
+type CreateCommentReply struct{}
+
+// LabelRequest is SCMCallback.AddLabel/RemoveLabel's request.
+type LabelRequest struct {
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	Number int32  `json:"number"`
+	Label  string `json:"label"`
+}
+
+// LabelReply is SCMCallback.AddLabel/RemoveLabel's (empty) response.
+type LabelReply struct{}
@@ -0,0 +1,195 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package externalplugin
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// ExternalPluginClient is the client half of the ExternalPlugin gRPC service.
+type ExternalPluginClient interface {
+	Handle(ctx context.Context, in *HookEvent, opts ...grpc.CallOption) (*HandleReply, error)
+}
+
+type externalPluginClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewExternalPluginClient wraps cc as an ExternalPluginClient.
+func NewExternalPluginClient(cc grpc.ClientConnInterface) ExternalPluginClient {
+	return &externalPluginClient{cc}
+}
+
+func (c *externalPluginClient) Handle(ctx context.Context, in *HookEvent, opts ...grpc.CallOption) (*HandleReply, error) {
+	opts = append(opts, grpc.ForceCodec(JSONCodec{}))
+	out := new(HandleReply)
+	if err := c.cc.Invoke(ctx, "/externalplugin.ExternalPlugin/Handle", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ExternalPluginServer is the server half of the ExternalPlugin gRPC service; external plugin
+// processes implement this (or the equivalent in their own language, from externalplugin.proto).
+type ExternalPluginServer interface {
+	Handle(ctx context.Context, in *HookEvent) (*HandleReply, error)
+}
+
+// RegisterExternalPluginServer registers srv on s.
+func RegisterExternalPluginServer(s grpc.ServiceRegistrar, srv ExternalPluginServer) {
+	s.RegisterService(&externalPluginServiceDesc, srv)
+}
+
+func externalPluginHandleHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HookEvent)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExternalPluginServer).Handle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/externalplugin.ExternalPlugin/Handle"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExternalPluginServer).Handle(ctx, req.(*HookEvent))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var externalPluginServiceDesc = grpc.ServiceDesc{
+	ServiceName: "externalplugin.ExternalPlugin",
+	HandlerType: (*ExternalPluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Handle", Handler: externalPluginHandleHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "externalplugin.proto",
+}
+
+// SCMCallbackClient is the client half of the SCMCallback gRPC service.
+type SCMCallbackClient interface {
+	CreateComment(ctx context.Context, in *CreateCommentRequest, opts ...grpc.CallOption) (*CreateCommentReply, error)
+	AddLabel(ctx context.Context, in *LabelRequest, opts ...grpc.CallOption) (*LabelReply, error)
+	RemoveLabel(ctx context.Context, in *LabelRequest, opts ...grpc.CallOption) (*LabelReply, error)
+}
+
+type scmCallbackClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewSCMCallbackClient wraps cc as a SCMCallbackClient.
+func NewSCMCallbackClient(cc grpc.ClientConnInterface) SCMCallbackClient {
+	return &scmCallbackClient{cc}
+}
+
+func (c *scmCallbackClient) CreateComment(ctx context.Context, in *CreateCommentRequest, opts ...grpc.CallOption) (*CreateCommentReply, error) {
+	opts = append(opts, grpc.ForceCodec(JSONCodec{}))
+	out := new(CreateCommentReply)
+	if err := c.cc.Invoke(ctx, "/externalplugin.SCMCallback/CreateComment", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scmCallbackClient) AddLabel(ctx context.Context, in *LabelRequest, opts ...grpc.CallOption) (*LabelReply, error) {
+	opts = append(opts, grpc.ForceCodec(JSONCodec{}))
+	out := new(LabelReply)
+	if err := c.cc.Invoke(ctx, "/externalplugin.SCMCallback/AddLabel", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scmCallbackClient) RemoveLabel(ctx context.Context, in *LabelRequest, opts ...grpc.CallOption) (*LabelReply, error) {
+	opts = append(opts, grpc.ForceCodec(JSONCodec{}))
+	out := new(LabelReply)
+	if err := c.cc.Invoke(ctx, "/externalplugin.SCMCallback/RemoveLabel", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SCMCallbackServer is the server half of the SCMCallback gRPC service; the lighthouse host
+// process implements this (see plugins.scmCallbackService).
+type SCMCallbackServer interface {
+	CreateComment(ctx context.Context, in *CreateCommentRequest) (*CreateCommentReply, error)
+	AddLabel(ctx context.Context, in *LabelRequest) (*LabelReply, error)
+	RemoveLabel(ctx context.Context, in *LabelRequest) (*LabelReply, error)
+}
+
+// RegisterSCMCallbackServer registers srv on s.
+func RegisterSCMCallbackServer(s grpc.ServiceRegistrar, srv SCMCallbackServer) {
+	s.RegisterService(&scmCallbackServiceDesc, srv)
+}
+
+func scmCallbackCreateCommentHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateCommentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SCMCallbackServer).CreateComment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/externalplugin.SCMCallback/CreateComment"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SCMCallbackServer).CreateComment(ctx, req.(*CreateCommentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func scmCallbackAddLabelHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LabelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SCMCallbackServer).AddLabel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/externalplugin.SCMCallback/AddLabel"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SCMCallbackServer).AddLabel(ctx, req.(*LabelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func scmCallbackRemoveLabelHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LabelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SCMCallbackServer).RemoveLabel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/externalplugin.SCMCallback/RemoveLabel"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SCMCallbackServer).RemoveLabel(ctx, req.(*LabelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var scmCallbackServiceDesc = grpc.ServiceDesc{
+	ServiceName: "externalplugin.SCMCallback",
+	HandlerType: (*SCMCallbackServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "CreateComment", Handler: scmCallbackCreateCommentHandler},
+		{MethodName: "AddLabel", Handler: scmCallbackAddLabelHandler},
+		{MethodName: "RemoveLabel", Handler: scmCallbackRemoveLabelHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "externalplugin.proto",
+}
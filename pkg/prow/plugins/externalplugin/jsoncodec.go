@@ -0,0 +1,50 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package externalplugin
+
+import "encoding/json"
+
+// jsonCodecName is the gRPC content-subtype this package's client and server force via
+// grpc.ForceCodec/grpc.ForceServerCodec.
+//
+// externalplugin.proto is the normative schema: a real protoc run (wired up once this module
+// carries a protoc toolchain in CI) would emit the usual protobuf-binary bindings, and any
+// third-party plugin generated that way can still talk to lighthouse by registering the same
+// codec name on its end. Until then, a JSON codec keeps the wire format something a plugin
+// author in any language can implement by hand from the .proto field names alone, without
+// needing a protobuf runtime for their language.
+const jsonCodecName = "json"
+
+// JSONCodec implements google.golang.org/grpc/encoding.Codec. Callers outside this package
+// (e.g. the plugin manager in pkg/prow/plugins) pass it to grpc.ForceCodec/ForceServerCodec so
+// client and server agree on the wire format.
+type JSONCodec struct{}
+
+// Marshal implements encoding.Codec.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements encoding.Codec.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name implements encoding.Codec.
+func (JSONCodec) Name() string {
+	return jsonCodecName
+}